@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -78,6 +79,20 @@ func (s *BeanqSuite) SetupSuite() {
 
 }
 
+func (s *BeanqSuite) TestClientClose() {
+
+	other := New(s.config)
+	s.Require().NotSame(s.client.broker, other.broker, "each client owns its broker")
+	s.Require().NotSame(s.client.Driver(), other.Driver(), "each client owns its connection")
+	s.Require().NotNil(GetBrokerDriver[redis.UniversalClient](), "the deprecated driver of the first client")
+
+	s.Require().NoError(other.Close())
+	s.Require().NoError(other.Close(), "Close can be called twice")
+
+	err := s.client.BQ().WithContext(s.ctx).Publish(s.normalChannel, s.normalTopic, s.normalPayload)
+	s.Require().NoError(err, "the other client keeps its connection")
+}
+
 func (s *BeanqSuite) TestConsume() {
 
 	proc, _ := os.FindProcess(os.Getpid())
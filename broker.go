@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
@@ -19,30 +20,29 @@ import (
 	"github.com/retail-ai-inc/beanq/v4/internal/capture"
 	"github.com/retail-ai-inc/beanq/v4/internal/driver/bmongo"
 	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
+	"github.com/rs/xid"
 	"github.com/spf13/cast"
 
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 )
 
-var (
-	brokerOnce sync.Once
-	broker     Broker
-)
-
 type Handler struct {
-	brokerImpl public.IBroker
-	do         func(ctx context.Context, data map[string]any, retry ...int) (int, error)
-	channel    string
-	topic      string
-	moodType   btype.MoodType
-	broker     string
-	prefix     string
-	retryCond  map[string]struct{}
+	brokerImpl  public.IBroker
+	idempotent  public.IIdempotent
+	enqueue     func(ctx context.Context, data map[string]any) error
+	do          func(ctx context.Context, data map[string]any, retry ...int) (int, error)
+	channel     string
+	topic       string
+	moodType    btype.MoodType
+	broker      string
+	prefix      string
+	retryCond   map[string]struct{}
+	idempotency time.Duration
 }
 
 func (h *Handler) Invoke(ctx context.Context, broker public.IBroker) {
 
-	broker.Dequeue(ctx, h.channel, h.topic, func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+	broker.Dequeue(ctx, h.channel, h.topic, h.withIdempotency(h.withChain(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
 		if len(retry) == 0 {
 			return h.do(ctx, data)
 		}
@@ -57,63 +57,179 @@ func (h *Handler) Invoke(ctx context.Context, broker public.IBroker) {
 			}
 			return false
 		})
-	})
+	})))
+}
+
+// withIdempotency skip the messages which are being handled or have already been handled successfully.
+// The id is claimed before the handler runs so concurrent redeliveries never both run it,
+// the claim expires after the timeToRun of the message in case the consumer dies,
+// and it is kept for `idempotency` once the handler returns no error.
+func (h *Handler) withIdempotency(do public.CallbackWithRetry) public.CallbackWithRetry {
+	if h.idempotency <= 0 || h.idempotent == nil {
+		return do
+	}
+	return func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		id := cast.ToString(data["id"])
+		if id == "" {
+			return do(ctx, data, retry...)
+		}
+
+		claimTTL := cast.ToDuration(data["timeToRun"])
+		if claimTTL <= 0 {
+			claimTTL = h.idempotency
+		}
+		token := xid.New().String()
+		claimed, err := h.idempotent.Claim(ctx, h.channel, h.topic, id, token, claimTTL)
+		if err != nil {
+			return 0, err
+		}
+		if !claimed {
+			logger.New().Info("Channel:[", h.channel, "]Topic:[", h.topic, "] skip processing or processed message:", id)
+			return 0, nil
+		}
+
+		n, err := do(ctx, data, retry...)
+		// a failure here only means the message may be handled again
+		finishCtx := context.WithoutCancel(ctx)
+		if err != nil {
+			if rerr := h.idempotent.Release(finishCtx, h.channel, h.topic, id, token); rerr != nil {
+				logger.New().Error(rerr)
+			}
+			return n, err
+		}
+		if err := h.idempotent.Done(finishCtx, h.channel, h.topic, id, token, h.idempotency); err != nil {
+			logger.New().Error(err)
+		}
+		return n, nil
+	}
 }
 
 type Broker struct {
-	status        public.IStatus
-	log           public.IProcessLog
-	client        any
-	fac           public.IBrokerFactory
+	// the drivers of config.Redis
+	brokerDriver
+	// connections the drivers of config.RedisConnections by name
+	connections   map[string]*brokerDriver
 	config        *BeanqConfig
 	tool          *bredis.UITool
 	handlers      []*Handler
 	captureConfig *capture.Config
+	// mongo the history of the broker, it's closed with the broker
+	mongo     *bmongo2.BMongo
+	closeOnce sync.Once
+	closeErr  error
 }
 
+// brokerDriver the drivers bound to one redis connection
+type brokerDriver struct {
+	status     public.IStatus
+	log        public.IProcessLog
+	idempotent public.IIdempotent
+	client     any
+	fac        public.IBrokerFactory
+}
+
+// openBrokers the brokers not closed yet in the order they were created, GetBrokerDriver returns the driver of the first one
+var openBrokers struct {
+	sync.Mutex
+	list []*Broker
+}
+
+// NewBroker connect a new broker, it owns its connections until Close
 func NewBroker(config *BeanqConfig) *Broker {
-	brokerOnce.Do(func() {
-		switch config.Broker {
-		case "redis":
-			cfg := config.Redis
-			client := bredis.NewRdb(cfg.Host, cfg.Port,
-				cfg.Password, cfg.Database,
-				cfg.MaxRetries, cfg.DialTimeout, cfg.ReadTimeout, cfg.WriteTimeout, cfg.PoolTimeout, cfg.PoolSize, cfg.MinIdleConnections)
-
-			broker.status = bredis.NewStatus(client, cfg.Prefix)
-			broker.log = bredis.NewProcessLog(client, cfg.Prefix)
-			broker.client = client
-			broker.fac = bredis.NewBroker(client, cfg.Prefix, cfg.MaxLen, config.MinConsumers, config.ConsumerPoolSize, config.DeadLetterIdleTime)
-			broker.tool = bredis.NewUITool(client, cfg.Prefix)
-			// capture errors and send them to email or Slack
-
-			if config.History.On {
-
-				mcfg := config.Mongo
-
-				collections := map[string]string{}
-				for s, collection := range mcfg.Collections {
-					collections[s] = collection.Name
-				}
+	broker := &Broker{config: config}
+	switch config.Broker {
+	case "redis":
+		if err := config.checkRedisRoutes(); err != nil {
+			logger.New().Fatal(err.Error())
+		}
+		if err := config.checkHistory(); err != nil {
+			logger.New().Fatal(err.Error())
+		}
+		prefix := config.Redis.Prefix
+		broker.brokerDriver = *newRedisDriver(config, config.Redis, prefix)
+
+		clients := make([]redis.UniversalClient, 0, len(config.RedisConnections))
+		broker.connections = make(map[string]*brokerDriver, len(config.RedisConnections))
+		for name, cfg := range config.RedisConnections {
+			driver := newRedisDriver(config, cfg, prefix)
+			broker.connections[name] = driver
+			clients = append(clients, driver.client.(redis.UniversalClient))
+		}
+		broker.tool = bredis.NewUITool(broker.client.(redis.UniversalClient), prefix).SetConnections(clients...)
+		// capture errors and send them to email or Slack
 
-				nmgo := bmongo2.NewMongo(mcfg.Host,
-					mcfg.Port, mcfg.UserName,
-					mcfg.Password,
-					mcfg.Database,
-					collections,
-					mcfg.ConnectTimeOut,
-					mcfg.MaxConnectionPoolSize,
-					mcfg.MaxConnectionLifeTime)
+		if config.History.On {
 
-				broker.captureConfig = getConfig(nmgo)
+			mcfg := config.Mongo
+
+			collections := map[string]string{}
+			for s, collection := range mcfg.Collections {
+				collections[s] = collection.Name
 			}
 
-		default:
-			logger.New().Panic("not support broker type:", config.Broker)
+			broker.mongo = bmongo2.Connect(mcfg.Host,
+				mcfg.Port, mcfg.UserName,
+				mcfg.Password,
+				mcfg.Database,
+				collections,
+				mcfg.ConnectTimeOut,
+				mcfg.MaxConnectionPoolSize,
+				mcfg.MaxConnectionLifeTime)
+
+			broker.captureConfig = getConfig(broker.mongo)
 		}
-	})
-	broker.config = config
-	return &broker
+
+	default:
+		logger.New().Panic("not support broker type:", config.Broker)
+	}
+	openBrokers.Lock()
+	openBrokers.list = append(openBrokers.list, broker)
+	openBrokers.Unlock()
+	return broker
+}
+
+func newRedisDriver(config *BeanqConfig, cfg Redis, prefix string) *brokerDriver {
+	options, err := cfg.options()
+	if err != nil {
+		logger.New().Fatal(err.Error())
+	}
+	maxLen := cfg.MaxLen
+	if maxLen == 0 {
+		maxLen = config.Redis.MaxLen
+	}
+	client := bredis.NewRdb(cfg.Host, cfg.Port,
+		cfg.Password, cfg.Database,
+		cfg.MaxRetries, cfg.DialTimeout, cfg.ReadTimeout, cfg.WriteTimeout, cfg.PoolTimeout, cfg.PoolSize, cfg.MinIdleConnections, options)
+
+	return &brokerDriver{
+		status:     bredis.NewStatus(client, prefix),
+		log:        bredis.NewProcessLog(client, prefix).SetMaxLen(config.History.LogMaxLen).SetMigrated(config.History.On),
+		idempotent: bredis.NewIdempotent(client, prefix),
+		client:     client,
+		fac: bredis.NewBroker(client, prefix, maxLen, config.MinConsumers, config.ConsumerPoolSize, config.DeadLetterIdleTime).
+			SetPriorityLanes(config.PriorityLanes, config.PriorityStarvation).
+			SetDeadLetter(config.DeadLetterTicker, config.DeadLetterBatch).
+			SetLogMaxLen(config.History.LogMaxLen).
+			SetLogMigrated(config.History.On),
+	}
+}
+
+// driver the drivers of the connection the stream of channel and topic is routed to
+func (t *Broker) driver(channel, topic string) *brokerDriver {
+	if driver, ok := t.connections[t.config.redisConnection(channel, topic)]; ok {
+		return driver
+	}
+	return &t.brokerDriver
+}
+
+// drivers the default drivers first, then the named connections
+func (t *Broker) drivers() []*brokerDriver {
+	drivers := make([]*brokerDriver, 0, len(t.connections)+1)
+	drivers = append(drivers, &t.brokerDriver)
+	for _, driver := range t.connections {
+		drivers = append(drivers, driver)
+	}
+	return drivers
 }
 
 func getConfig(client *bmongo2.BMongo) *capture.Config {
@@ -132,7 +248,7 @@ func getConfig(client *bmongo2.BMongo) *capture.Config {
 
 func (t *Broker) ForceUnlock(ctx context.Context, channel, topic, orderKey string) error {
 
-	return t.fac.Mood(btype.SEQUENCE_BY_LOCK, t.captureConfig).ForceUnlock(ctx, channel, topic, orderKey)
+	return t.driver(channel, topic).fac.Mood(btype.SEQUENCE_BY_LOCK, t.captureConfig).ForceUnlock(ctx, channel, topic, orderKey)
 
 }
 
@@ -143,27 +259,19 @@ func (t *Broker) Enqueue(ctx context.Context, data map[string]any) error {
 		moodType = btype.MoodType(cast.ToString(v))
 	}
 
-	bk := t.fac.Mood(moodType, t.captureConfig)
+	bk := t.driver(cast.ToString(data["channel"]), cast.ToString(data["topic"])).fac.Mood(moodType, t.captureConfig)
 	if bk == nil {
 		return bstatus.BrokerDriverError
 	}
-	if err := bk.Enqueue(ctx, data); err != nil {
-		return err
-	}
-	data["status"] = bstatus.StatusPublished
-
-	if err := t.log.AddLog(ctx, data); err != nil {
-		return err
-	}
-
-	return nil
+	// the mood writes the message and its published log together
+	return bk.Enqueue(ctx, data)
 }
 
 func (t *Broker) Dequeue(ctx context.Context, channel, topic string, do public.CallbackWithRetry) {
 }
 
 func (t *Broker) Status(ctx context.Context, channel, topic, id string, isOrder bool) (map[string]string, error) {
-	data, err := t.status.Status(ctx, channel, topic, id, isOrder)
+	data, err := t.driver(channel, topic).status.Status(ctx, channel, topic, id, isOrder)
 	if err != nil {
 		// todo
 		return nil, err
@@ -179,6 +287,7 @@ func (t *Broker) AddConsumer(moodType btype.MoodType, channel, topic string, sub
 		channel:  channel,
 		topic:    topic,
 		moodType: moodType,
+		enqueue:  t.Enqueue,
 		do: func(ctx context.Context, message map[string]any, retry ...int) (int, error) {
 
 			var gerr error
@@ -192,7 +301,7 @@ func (t *Broker) AddConsumer(moodType btype.MoodType, channel, topic string, sub
 			return 0, gerr
 		},
 	}
-	handler.brokerImpl = t.fac.Mood(moodType, t.captureConfig)
+	handler.brokerImpl = t.mood(moodType, channel, topic)
 	t.handlers = append(t.handlers, &handler)
 
 	return nil
@@ -202,24 +311,51 @@ func (t *Broker) Migrate(ctx context.Context, data []map[string]any) error {
 
 	var migrate public.IMigrateLog
 
-	if t.config.Broker == "redis" {
-		if t.config.History.On {
-			mongo := t.config.Mongo
-			migrate = bmongo.NewMongoLog(ctx,
-				mongo.Host,
-				mongo.Port,
-				mongo.ConnectTimeOut,
-				mongo.MaxConnectionLifeTime,
-				mongo.MaxConnectionPoolSize,
-				mongo.Database,
-				mongo.Collections["event"].Name,
-				mongo.UserName,
-				mongo.Password)
+	if t.config.Broker != "redis" {
+		return nil
+	}
+	if t.config.History.On {
+		mongo := t.config.Mongo
+		migrate = bmongo.NewMongoLog(ctx,
+			mongo.Host,
+			mongo.Port,
+			mongo.ConnectTimeOut,
+			mongo.MaxConnectionLifeTime,
+			mongo.MaxConnectionPoolSize,
+			mongo.Database,
+			mongo.Collections["event"].Name,
+			mongo.UserName,
+			mongo.Password)
+	}
+
+	// the logs of every connection spill to the same directory, its interrupted replays are handed back once
+	// before any of them migrates
+	spill := t.config.History.Overflow == LogOverflowSpill
+	if spill {
+		if err := bredis.RecoverSpill(t.config.History.SpillDir); err != nil {
+			logger.New().Error(err)
 		}
-		migrate = bredis.NewLog(t.client.(redis.UniversalClient), t.config.Redis.Prefix, migrate)
 	}
 
-	return migrate.Migrate(ctx, nil)
+	// every connection has its own logic log stream
+	drivers := t.drivers()
+	errs := make([]error, len(drivers))
+	var wg sync.WaitGroup
+	for i, driver := range drivers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log := bredis.NewLog(driver.client.(redis.UniversalClient), t.config.Redis.Prefix, migrate).
+				SetCaptureConfig(t.captureConfig)
+			if spill {
+				log.SetSpillDir(t.config.History.SpillDir)
+			}
+			errs[i] = log.Migrate(ctx, nil)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
 func (t *Broker) Start(ctx context.Context) {
@@ -279,8 +415,42 @@ func (t *Broker) Mood(m btype.MoodType) public.IBroker {
 	return t.fac.Mood(m, t.captureConfig)
 }
 
+// mood the driver of moodType on the connection of channel and topic
+func (t *Broker) mood(m btype.MoodType, channel, topic string) public.IBroker {
+	return t.driver(channel, topic).fac.Mood(m, t.captureConfig)
+}
+
+// Close release the connections of the broker, it's safe to call more than once
+func (t *Broker) Close() error {
+	t.closeOnce.Do(func() {
+		for _, driver := range t.drivers() {
+			if client, ok := driver.client.(redis.UniversalClient); ok {
+				t.closeErr = errors.Join(t.closeErr, client.Close())
+			}
+		}
+		if t.mongo != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			t.closeErr = errors.Join(t.closeErr, t.mongo.Close(ctx))
+		}
+		openBrokers.Lock()
+		openBrokers.list = slices.DeleteFunc(openBrokers.list, func(broker *Broker) bool { return broker == t })
+		openBrokers.Unlock()
+	})
+	return t.closeErr
+}
+
+// GetBrokerDriver the driver client of the oldest client still open, e.g. redis.UniversalClient with the redis broker.
+//
+// Deprecated: every client owns its connection, use (*Client).Driver.
 func GetBrokerDriver[T any]() T {
-	if broker.config.Broker == "" {
+	openBrokers.Lock()
+	var broker *Broker
+	if len(openBrokers.list) > 0 {
+		broker = openBrokers.list[0]
+	}
+	openBrokers.Unlock()
+	if broker == nil {
 		logger.New().Panic("the broker has not been initialized yet")
 	}
 	if broker.config.Broker == "redis" {
@@ -325,7 +495,31 @@ func (c WorkflowHandler) Handle(ctx context.Context, message *Message) error {
 	if err != nil {
 		return err
 	}
-	return c(ctx, workflow)
+	err = c(ctx, workflow)
+	if errors.Is(err, ErrWorkflowOngoing) {
+		// the workflow is parked, SignalWorkflow publishes the message again to resume it
+		return nil
+	}
+	return err
+}
+
+// workflowConsumer gives the workflows of a WorkflowHandler the broker of the client which consumes them
+type workflowConsumer struct {
+	handler WorkflowHandler
+	broker  *Broker
+}
+
+func (c workflowConsumer) Handle(ctx context.Context, message *Message) error {
+	workflow, err := NewWorkflow(ctx, message)
+	if err != nil {
+		return err
+	}
+	workflow.broker = c.broker
+	err = c.handler(ctx, workflow)
+	if errors.Is(err, ErrWorkflowOngoing) {
+		return nil
+	}
+	return err
 }
 
 func (c DefaultHandle) Handle(ctx context.Context, message *Message) error {
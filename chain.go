@@ -0,0 +1,157 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/json"
+	"github.com/retail-ai-inc/beanq/v4/helper/timex"
+	"github.com/retail-ai-inc/beanq/v4/internal"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+	"github.com/rs/xid"
+	"github.com/spf13/cast"
+)
+
+type (
+	// ChainStep one message of a chain
+	ChainStep struct {
+		Channel string `json:"channel"`
+		Topic   string `json:"topic"`
+		Payload string `json:"payload"`
+	}
+
+	// continuation the rest of a chain, it travels with the message under the `chain` key
+	continuation struct {
+		OnFailure *ChainStep  `json:"onFailure,omitempty"`
+		Next      []ChainStep `json:"next,omitempty"`
+	}
+
+	// ChainCmd publish a pipeline of normal messages,
+	// the consumer of a step publishes the next one after its handler succeeds.
+	ChainCmd struct {
+		bq        *BQClient
+		onFailure *ChainStep
+		steps     []ChainStep
+	}
+)
+
+// Chain
+// e.g. bq.Chain().Then("image", "resize", payload).Then("user", "notify", payload).OnFailure("user", "resize-failed", payload).Publish()
+func (b *BQClient) Chain() *ChainCmd {
+	return &ChainCmd{bq: b}
+}
+
+// Then append a step, the first step is published at once.
+func (c *ChainCmd) Then(channel, topic string, payload []byte) *ChainCmd {
+	c.steps = append(c.steps, ChainStep{Channel: channel, Topic: topic, Payload: string(payload)})
+	return c
+}
+
+// OnFailure is published when any step still fails after its last retry, the rest of the chain is dropped.
+func (c *ChainCmd) OnFailure(channel, topic string, payload []byte) *ChainCmd {
+	c.onFailure = &ChainStep{Channel: channel, Topic: topic, Payload: string(payload)}
+	return c
+}
+
+func (c *ChainCmd) Publish() error {
+	if len(c.steps) == 0 {
+		return errors.New("chain has no steps")
+	}
+
+	next := continuation{OnFailure: c.onFailure, Next: c.steps[1:]}
+	chain, err := next.encode()
+	if err != nil {
+		return err
+	}
+	c.bq.chain = chain
+	defer func() {
+		c.bq.chain = ""
+	}()
+
+	head := c.steps[0]
+	return c.bq.Publish(head.Channel, head.Topic, []byte(head.Payload))
+}
+
+func (c continuation) encode() (string, error) {
+	if c.OnFailure == nil && len(c.Next) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func decodeContinuation(chain string) (*continuation, error) {
+	if chain == "" {
+		return nil, nil
+	}
+	var c continuation
+	if err := json.Unmarshal([]byte(chain), &c); err != nil {
+		return nil, fmt.Errorf("decode chain: %w", err)
+	}
+	return &c, nil
+}
+
+// message build the message of a step, it inherits the retry and time settings of the current message
+func (s ChainStep) message(current map[string]any, chain string) map[string]any {
+	now := time.Now()
+	message := Message{
+		Id:          xid.NewWithTime(now).String(),
+		Channel:     s.Channel,
+		Topic:       s.Topic,
+		Payload:     s.Payload,
+		MoodType:    btype.NORMAL,
+		AddTime:     now.Format(timex.DateTime),
+		ExecuteTime: now,
+		MaxLen:      cast.ToInt64(current["maxLen"]),
+		Retry:       cast.ToInt(current["retry"]),
+		TimeToRun:   cast.ToDuration(current["timeToRun"]),
+		Chain:       chain,
+	}
+	return message.ToMap()
+}
+
+// withChain publish the next step when the handler succeeds, or the failure step when it finally fails
+func (h *Handler) withChain(do public.CallbackWithRetry) public.CallbackWithRetry {
+	if h.enqueue == nil {
+		return do
+	}
+	return func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		n, err := do(ctx, data, retry...)
+
+		c, cerr := decodeContinuation(cast.ToString(data["chain"]))
+		if cerr != nil {
+			return n, errors.Join(err, cerr)
+		}
+		if c == nil {
+			return n, err
+		}
+
+		// the step is published even if the session has timed out
+		ctx = context.WithoutCancel(ctx)
+		if err != nil {
+			if c.OnFailure != nil {
+				if ferr := h.enqueue(ctx, c.OnFailure.message(data, "")); ferr != nil {
+					err = errors.Join(err, fmt.Errorf("publish failure step: %w", ferr))
+				}
+			}
+			return n, err
+		}
+		if len(c.Next) == 0 {
+			return n, nil
+		}
+
+		rest, cerr := continuation{OnFailure: c.OnFailure, Next: c.Next[1:]}.encode()
+		if cerr != nil {
+			return n, cerr
+		}
+		if cerr := h.enqueue(ctx, c.Next[0].message(data, rest)); cerr != nil {
+			return n, fmt.Errorf("publish next step: %w", cerr)
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,58 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spf13/cast"
+)
+
+func TestHandler_withChain(t *testing.T) {
+	chain, err := continuation{
+		OnFailure: &ChainStep{Channel: "user", Topic: "failed", Payload: "f"},
+		Next: []ChainStep{
+			{Channel: "user", Topic: "notify", Payload: "n"},
+			{Channel: "user", Topic: "audit", Payload: "a"},
+		},
+	}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var published []map[string]any
+	h := &Handler{enqueue: func(ctx context.Context, data map[string]any) error {
+		published = append(published, data)
+		return nil
+	}}
+
+	succeed := h.withChain(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		return 0, nil
+	})
+	if _, err := succeed(context.Background(), map[string]any{"chain": chain, "retry": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(published) != 1 || published[0]["topic"] != "notify" || cast.ToInt(published[0]["retry"]) != 3 {
+		t.Fatalf("Expected the notify step to be published, got: %+v", published)
+	}
+
+	next, err := decodeContinuation(cast.ToString(published[0]["chain"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Next) != 1 || next.Next[0].Topic != "audit" || next.OnFailure == nil {
+		t.Fatalf("Expected audit to be left with the failure step, got: %+v", next)
+	}
+
+	published = nil
+	handlerErr := errors.New("handler failed")
+	fail := h.withChain(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		return 0, handlerErr
+	})
+	if _, err := fail(context.Background(), map[string]any{"chain": chain}); !errors.Is(err, handlerErr) {
+		t.Fatalf("Expected the handler error, got: %v", err)
+	}
+	if len(published) != 1 || published[0]["topic"] != "failed" || published[0]["chain"] != nil {
+		t.Fatalf("Expected only the failure step to be published, got: %+v", published)
+	}
+}
@@ -29,9 +29,11 @@ import (
 	"os"
 	"os/signal"
 	"slices"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 	"github.com/retail-ai-inc/beanq/v4/helper/timex"
 	"github.com/retail-ai-inc/beanq/v4/internal/btype"
@@ -104,6 +106,17 @@ func (c *Client) ForceUnlock(ctx context.Context, channel, topic, orderKey strin
 	return c.broker.ForceUnlock(ctx, channel, topic, orderKey)
 }
 
+// Close release the connections of the client at once, the other clients created with New keep theirs.
+// The consumers must have stopped first, call it after Wait has returned.
+func (c *Client) Close() error {
+	return c.broker.Close()
+}
+
+// Driver the driver client of the default connection, e.g. redis.UniversalClient with the redis broker
+func (c *Client) Driver() any {
+	return c.broker.client
+}
+
 func WithCaptureExceptionOption(handler func(ctx context.Context, err any)) ClientOption {
 	return func(client *Client) {
 		client.captureException = handler
@@ -139,11 +152,16 @@ func (c *Client) BQ() *BQClient {
 	return bqc
 }
 
+// Wait runs the consumers until SIGTERM or SIGINT, then stops reading and returns once the messages
+// being handled are done, so Close can be called right after it.
 func (c *Client) Wait(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
+	var consumers sync.WaitGroup
 	for key, handler := range c.broker.handlers {
+		consumers.Add(1)
 		go func(hdl Handler) {
-			brokerImpl := c.broker.Mood(hdl.moodType)
+			defer consumers.Done()
+			brokerImpl := c.broker.mood(hdl.moodType, hdl.channel, hdl.topic)
 			hdl.Invoke(ctx, brokerImpl)
 		}(*handler)
 		c.broker.handlers[key] = nil
@@ -178,6 +196,7 @@ func (c *Client) Wait(ctx context.Context) {
 	logger.New().Info("Beanq Start")
 	// monitor signal
 	<-c.WaitSignal(cancel)
+	consumers.Wait()
 }
 
 func (c *Client) WaitSignal(cancel context.CancelFunc) <-chan bool {
@@ -196,13 +215,30 @@ func (c *Client) WaitSignal(cancel context.CancelFunc) <-chan bool {
 	return done
 }
 
-func (c *Client) AddConsumer(moodType btype.MoodType, channel, topic string, subscribe IConsumeHandle, retryConditions map[string]struct{}) error {
+// ConsumerOption configures a handler registered by AddConsumer
+type ConsumerOption func(*Handler)
+
+// WithConsumerIdempotency a message id which is being handled, or has been handled successfully within `ttl`,
+// will not be handled again.
+func WithConsumerIdempotency(ttl time.Duration) ConsumerOption {
+	return func(h *Handler) {
+		h.idempotency = ttl
+	}
+}
+
+// AddConsumer register a handler
+func (c *Client) AddConsumer(moodType btype.MoodType, channel, topic string, subscribe IConsumeHandle, retryConditions map[string]struct{}, options ...ConsumerOption) error {
+	if wh, ok := subscribe.(WorkflowHandler); ok {
+		subscribe = workflowConsumer{handler: wh, broker: c.broker}
+	}
 
 	handler := Handler{
-		channel:   channel,
-		topic:     topic,
-		moodType:  moodType,
-		retryCond: retryConditions,
+		channel:    channel,
+		topic:      topic,
+		moodType:   moodType,
+		retryCond:  retryConditions,
+		idempotent: c.broker.driver(channel, topic).idempotent,
+		enqueue:    c.broker.Enqueue,
 		do: func(ctx context.Context, message map[string]any, retry ...int) (int, error) {
 			var gerr error
 			msg := messageToStruct(message)
@@ -216,6 +252,10 @@ func (c *Client) AddConsumer(moodType btype.MoodType, channel, topic string, sub
 		},
 	}
 
+	for _, option := range options {
+		option(&handler)
+	}
+
 	c.broker.handlers = append(c.broker.handlers, &handler)
 	return nil
 }
@@ -231,6 +271,37 @@ func (c *Client) CheckAckStatus(ctx context.Context, channel, topic, id string,
 	return MessageS(m).ToMessage(), nil
 }
 
+// SignalWorkflow send the signal `name` to the workflow `gid` and publish its message again,
+// so the task waiting by WaitForSignal resumes with `payload`. InitWorkflow must be called first.
+// A workflow kept in another store by WfOptionTransStore is signaled by SignalWorkflowIn.
+func (c *Client) SignalWorkflow(ctx context.Context, gid, name string, payload []byte) error {
+	if workflowTransStore == nil {
+		return errors.New("workflow client not initialized")
+	}
+	return c.SignalWorkflowIn(ctx, workflowTransStore, gid, name, payload)
+}
+
+// SignalWorkflowIn SignalWorkflow for a workflow kept in `store`, the one given to WfOptionTransStore.
+func (c *Client) SignalWorkflowIn(ctx context.Context, store TransStore, gid, name string, payload []byte) error {
+	global, err := store.FindGlobal(ctx, gid)
+	if err != nil {
+		return err
+	}
+	if global == nil {
+		return fmt.Errorf("workflow %s: %w", gid, ErrNotFound)
+	}
+	if global.Status != StatusPrepared {
+		return fmt.Errorf("workflow %s is %s, it can't receive signals", gid, global.Status)
+	}
+
+	// save the signal before publishing, the resumed run must see it
+	if err := store.SaveSignal(ctx, gid, name, payload); err != nil {
+		return err
+	}
+
+	return resumeWorkflow(ctx, store, c.broker, gid)
+}
+
 // Ping this method can be called by user for checking the status of broker
 func (c *Client) Ping() {
 }
@@ -245,6 +316,14 @@ type BQClient struct {
 	waitAck         bool
 	lockOrderKeyTTL time.Duration
 	retryConditions map[string]struct{}
+	dedupKey        string
+	dedupWindow     time.Duration
+	dedupSilently   bool
+	idempotency     time.Duration
+	collapseKey     string
+	collapseMode    btype.CollapseMode
+	collapseWindow  time.Duration
+	chain           string
 }
 
 func (b *BQClient) WithContext(ctx context.Context) *BQClient {
@@ -275,6 +354,9 @@ func (b *BQClient) GetId() string {
 	return b.id
 }
 
+// Priority range [0,999].
+// Delay messages with the same execute time are consumed from the highest priority,
+// normal messages are routed to a priority lane when `priorityLanes` is greater than 1.
 func (b *BQClient) Priority(priority float64) *BQClient {
 	if priority >= 1000 {
 		priority = 999
@@ -300,6 +382,51 @@ func (b *BQClient) SetLockOrderKeyTTL(duration time.Duration) *BQClient {
 	return b
 }
 
+// Dedup only support Normal and Delay type for now.
+// A publish with the same key within `window` is rejected with an error wrapping bstatus.ErrIdempotent.
+func (b *BQClient) Dedup(key string, window time.Duration) *BQClient {
+	b.dedupKey = key
+	b.dedupWindow = window
+	b.dedupSilently = false
+	return b
+}
+
+// DedupSilently same as Dedup, but the duplicate publish is dropped without an error.
+func (b *BQClient) DedupSilently(key string, window time.Duration) *BQClient {
+	b.Dedup(key, window)
+	b.dedupSilently = true
+	return b
+}
+
+// Debounce collapses the publishes of the same key within `window` into one delivery carrying the last payload.
+// The delivery happens `window` after the first publish. It only supports delay messages,
+// publish them with PublishAtTime and consume them with SubscribeToDelay. It can't be combined with Dedup.
+func (b *BQClient) Debounce(key string, window time.Duration) *BQClient {
+	b.collapseKey = key
+	b.collapseMode = btype.DEBOUNCE
+	b.collapseWindow = window
+	return b
+}
+
+// Throttle delivers at most one message of the same key per `interval`.
+// The first publish is delivered at once, later ones collapse into one delivery at the next free slot carrying the last payload.
+// It only supports delay messages, publish them with PublishAtTime and consume them with SubscribeToDelay.
+// It can't be combined with Dedup.
+func (b *BQClient) Throttle(key string, interval time.Duration) *BQClient {
+	b.collapseKey = key
+	b.collapseMode = btype.THROTTLE
+	b.collapseWindow = interval
+	return b
+}
+
+// WithIdempotency only takes effect on Subscribe.
+// The id of a successfully handled message is kept for `ttl`,
+// a redelivery of it (dead letter, retry from the UI) within `ttl` is acked without calling the handler.
+func (b *BQClient) WithIdempotency(ttl time.Duration) *BQClient {
+	b.idempotency = ttl
+	return b
+}
+
 func (b *BQClient) IgnoreRetryConditions(err ...error) *BQClient {
 
 	retryConditions := make(map[string]struct{}, len(err))
@@ -380,6 +507,26 @@ func (b *BQClient) process(cmd IBaseCmd) error {
 				return errors.New("please configure a unique ID")
 			}
 		}
+		// debounce and throttle are built on the delay queue, a Subscribe consumer would never see them
+		if b.collapseKey != "" && cmd.moodType == btype.NORMAL {
+			return fmt.Errorf("%s only supports delay messages, publish with PublishAtTime and consume with SubscribeToDelay", b.collapseMode)
+		}
+		collapse := b.collapseKey != "" && cmd.moodType == btype.DELAY
+		if collapse {
+			if b.collapseWindow <= 0 {
+				return fmt.Errorf("%s window must be greater than 0", b.collapseMode)
+			}
+			if b.collapseMode == btype.DEBOUNCE {
+				cmd.executeTime = cmd.executeTime.Add(b.collapseWindow)
+			}
+		}
+		dedup := b.dedupKey != "" && (cmd.moodType == btype.NORMAL || cmd.moodType == btype.DELAY)
+		if dedup && b.dedupWindow <= 0 {
+			return errors.New("dedup window must be greater than 0")
+		}
+		if dedup && collapse {
+			return fmt.Errorf("dedup can't be combined with %s", b.collapseMode)
+		}
 		// make message
 		message := &Message{
 			Topic:           topic,
@@ -401,6 +548,21 @@ func (b *BQClient) process(cmd IBaseCmd) error {
 			TimeToRun:      b.client.TimeToRun,
 			TimeToRunLimit: b.client.TimeToRunLimit,
 		}
+		if dedup {
+			message.DedupKey = b.dedupKey
+			message.DedupWindow = b.dedupWindow
+		}
+		if collapse {
+			message.CollapseKey = b.collapseKey
+			message.CollapseMode = b.collapseMode
+			message.CollapseWindow = b.collapseWindow
+		}
+		if b.chain != "" {
+			if cmd.moodType != btype.NORMAL {
+				return errors.New("chain only supports normal messages")
+			}
+			message.Chain = b.chain
+		}
 
 		if err := cmd.filter(message); err != nil {
 			return err
@@ -411,7 +573,11 @@ func (b *BQClient) process(cmd IBaseCmd) error {
 		}
 
 		// store message
-		return b.client.broker.Enqueue(b.ctx, message.ToMap())
+		err := b.client.broker.Enqueue(b.ctx, message.ToMap())
+		if dedup && b.dedupSilently && errors.Is(err, bstatus.ErrIdempotent) {
+			return nil
+		}
+		return err
 		// return b.client.broker.enqueue(b.ctx, message, b.dynamicOption.on)
 
 	case *Subscribe:
@@ -427,7 +593,7 @@ func (b *BQClient) process(cmd IBaseCmd) error {
 		if b.dynamicOption.on {
 			// TODO: maybe need this feature in the future.
 		} else {
-			if err := b.client.AddConsumer(cmd.moodType, channel, topic, cmd.handle, b.retryConditions); err != nil {
+			if err := b.client.AddConsumer(cmd.moodType, channel, topic, cmd.handle, b.retryConditions, WithConsumerIdempotency(b.idempotency)); err != nil {
 				return err
 			}
 		}
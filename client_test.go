@@ -0,0 +1,119 @@
+package beanq
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+)
+
+func TestBQClient_collapse(t *testing.T) {
+	client := &Client{Channel: "default-channel", Topic: "default-topic"}
+
+	tests := []struct {
+		name    string
+		publish func(bq *BQClient) error
+	}{
+		{"debounce on a normal publish", func(bq *BQClient) error {
+			return bq.Debounce("user-1", time.Second).Publish("channel", "topic", []byte("1"))
+		}},
+		{"throttle on a normal publish", func(bq *BQClient) error {
+			return bq.Throttle("user-1", time.Second).Publish("channel", "topic", []byte("1"))
+		}},
+		{"debounce without a window", func(bq *BQClient) error {
+			return bq.Debounce("user-1", 0).PublishAtTime("channel", "topic", []byte("1"), time.Now())
+		}},
+		{"dedup and debounce", func(bq *BQClient) error {
+			return bq.Dedup("order-1", time.Second).Debounce("user-1", time.Second).
+				PublishAtTime("channel", "topic", []byte("1"), time.Now())
+		}},
+		{"dedup and throttle", func(bq *BQClient) error {
+			return bq.Dedup("order-1", time.Second).Throttle("user-1", time.Second).
+				PublishAtTime("channel", "topic", []byte("1"), time.Now())
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.publish(client.BQ()); err == nil {
+				t.Fatal("expected the publish to be rejected")
+			}
+		})
+	}
+}
+
+func TestClient_Wait(t *testing.T) {
+	// the signal stops Wait instead of the test
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	client := New(newTestConfig(t, "beanq_wait_test"))
+	var handled atomic.Bool
+	started := make(chan struct{})
+	_, err := client.BQ().Subscribe("wait-channel", "wait-topic", DefaultHandle{
+		DoHandle: func(ctx context.Context, message *Message) error {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			handled.Store(true)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.BQ().Publish("wait-channel", "wait-topic", []byte("wait")); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		<-started
+		_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	client.Wait(context.Background())
+	if !handled.Load() {
+		t.Error("Expected Wait to return once the message being handled is done")
+	}
+	if err := client.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClient_CloseHandsOverDriver(t *testing.T) {
+	config := newTestConfig(t, "beanq_close_test")
+	first, second := New(config), New(config)
+	defer second.Close()
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if driver := GetBrokerDriver[redis.UniversalClient](); driver != second.Driver() {
+		t.Error("Expected the driver of the client still open")
+	}
+}
+
+func TestClient_retryRoute(t *testing.T) {
+	config := newTestConfig(t, "beanq_retry_test")
+	config.PriorityLanes = 2
+	client := New(config)
+	defer client.Close()
+	rdb := client.Driver().(redis.UniversalClient)
+
+	message := Message{Id: "retry-1", Channel: "retry-channel", Topic: "retry-topic", MoodType: btype.NORMAL, Payload: "1", Priority: 999}
+	broker := client.retryRoute()(btype.NORMAL, message.Channel, message.Topic)
+	if err := broker.Enqueue(context.Background(), message.ToMap()); err != nil {
+		t.Fatal(err)
+	}
+	if n := rdb.XLen(context.Background(), tool.MakeLogicKey("beanq_retry_test")).Val(); n != 1 {
+		t.Errorf("Expected the retry to be logged like a publish, got: %d", n)
+	}
+	lane := tool.MakePriorityStreamKey(btype.NormalSubscribe, "beanq_retry_test", message.Channel, message.Topic, 1)
+	if n := rdb.XLen(context.Background(), lane).Val(); n != 1 {
+		t.Errorf("Expected the retry in the lane of its priority, got: %d", n)
+	}
+}
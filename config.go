@@ -23,18 +23,32 @@
 package beanq
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"sync"
 	"time"
 
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 	"github.com/retail-ai-inc/beanq/v4/helper/ui"
 	"github.com/retail-ai-inc/beanq/v4/internal/boptions"
+	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
 	"github.com/spf13/viper"
 )
 
+const (
+	// LogOverflowDrop the logic log keeps trimming its oldest entries while the history is behind,
+	// with History.On every entry trimmed before migrated is counted and alerted
+	LogOverflowDrop = "drop"
+	// LogOverflowSpill the batches the history refuses are written to History.SpillDir
+	// and migrated once it is back, so the logic log doesn't grow into the trimming
+	LogOverflowSpill = "spill"
+)
+
 type (
 	DebugLog struct {
 		Path string `json:"path"`
@@ -58,6 +72,32 @@ type (
 		PoolTimeout        time.Duration `json:"poolTimeout"`
 		MaxRetries         int           `json:"maxRetries"`
 		PoolSize           int           `json:"poolSize"`
+		// Username the Redis 6 ACL user
+		Username string `json:"username"`
+		// MasterName the sentinel master, Host lists the sentinels then
+		MasterName       string   `json:"masterName"`
+		SentinelUsername string   `json:"sentinelUsername"`
+		SentinelPassword string   `json:"sentinelPassword"`
+		TLS              RedisTLS `json:"tls"`
+		// TLSConfig is used as is instead of TLS, for the configs built in code
+		TLSConfig *tls.Config `json:"-"`
+	}
+	RedisTLS struct {
+		On bool `json:"on"`
+		// CAFile the PEM certificates the server certificate is verified with, the system pool when empty
+		CAFile string `json:"caFile"`
+		// CertFile and KeyFile the PEM client certificate and its key, for mutual TLS
+		CertFile           string `json:"certFile"`
+		KeyFile            string `json:"keyFile"`
+		ServerName         string `json:"serverName"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	}
+	// RedisRoute sends the streams whose channel and topic match to a named connection,
+	// the patterns use the syntax of path.Match and an empty one matches everything.
+	RedisRoute struct {
+		Channel    string `json:"channel"`
+		Topic      string `json:"topic"`
+		Connection string `json:"connection"`
 	}
 	Queue struct {
 		Topic        string
@@ -71,6 +111,12 @@ type (
 	History struct {
 		Storage string `json:"storage"`
 		On      bool
+		// LogMaxLen the logic log stream waiting for the migration is trimmed to about this many entries
+		LogMaxLen int64 `json:"logMaxLen"`
+		// Overflow what happens to the logs the history refuses, LogOverflowDrop or LogOverflowSpill
+		Overflow string `json:"overflow"`
+		// SpillDir the directory LogOverflowSpill writes to, one per process
+		SpillDir string `json:"spillDir"`
 	}
 
 	UI struct {
@@ -123,11 +169,17 @@ type (
 		*Mongo   `json:"mongo"`
 		DebugLog `json:"debugLog"`
 		Queue
-		History                  `json:"history"`
-		WorkFlow                 `json:"workflow"`
-		Redis                    Redis         `json:"redis"`
-		DeadLetterIdleTime       time.Duration `json:"deadLetterIdle"`
-		DeadLetterTicker         time.Duration `json:"deadLetterTicker"`
+		History  `json:"history"`
+		WorkFlow `json:"workflow"`
+		Redis    Redis `json:"redis"`
+		// RedisConnections the named connections besides Redis, their streams keep the prefix of Redis
+		RedisConnections map[string]Redis `json:"redisConnections"`
+		// RedisRoutes the first matching route picks the connection of a stream, the others stay on Redis
+		RedisRoutes        []RedisRoute  `json:"redisRoutes"`
+		DeadLetterIdleTime time.Duration `json:"deadLetterIdle"`
+		DeadLetterTicker   time.Duration `json:"deadLetterTicker"`
+		// DeadLetterBatch the number of idle pending messages reclaimed by one XAUTOCLAIM
+		DeadLetterBatch          int64         `json:"deadLetterBatch"`
 		KeepFailedJobsInHistory  time.Duration `json:"keepFailedJobsInHistory"`
 		KeepSuccessJobsInHistory time.Duration `json:"keepSuccessJobsInHistory"`
 		PublishTimeOut           time.Duration `json:"publishTimeOut"`
@@ -135,6 +187,12 @@ type (
 		MinConsumers             int64         `json:"minConsumers"`
 		JobMaxRetries            int           `json:"jobMaxRetries"`
 		ConsumerPoolSize         int           `json:"consumerPoolSize"`
+		// PriorityLanes splits every normal topic into N streams by message priority,
+		// 1 keeps the single FIFO stream.
+		PriorityLanes int `json:"priorityLanes"`
+		// PriorityStarvation is the number of batches a lower lane may be passed over
+		// before it gets read first, a negative value disables the protection.
+		PriorityStarvation int `json:"priorityStarvation"`
 	}
 )
 
@@ -142,6 +200,12 @@ func (t *BeanqConfig) init() {
 	if t.ConsumerPoolSize == 0 {
 		t.ConsumerPoolSize = boptions.DefaultOptions.ConsumerPoolSize
 	}
+	if t.PriorityLanes <= 0 {
+		t.PriorityLanes = boptions.DefaultOptions.PriorityLanes
+	}
+	if t.PriorityStarvation == 0 {
+		t.PriorityStarvation = boptions.DefaultOptions.PriorityStarvation
+	}
 	if t.JobMaxRetries < 0 {
 		t.JobMaxRetries = boptions.DefaultOptions.JobMaxRetry
 	}
@@ -151,6 +215,15 @@ func (t *BeanqConfig) init() {
 	if t.DeadLetterTicker == 0 {
 		t.DeadLetterTicker = boptions.DefaultOptions.DeadLetterTicker
 	}
+	if t.DeadLetterBatch <= 0 {
+		t.DeadLetterBatch = boptions.DefaultOptions.DeadLetterBatch
+	}
+	if t.History.LogMaxLen <= 0 {
+		t.History.LogMaxLen = boptions.DefaultOptions.LogMaxLen
+	}
+	if t.History.Overflow == "" {
+		t.History.Overflow = LogOverflowDrop
+	}
 
 	if t.KeepSuccessJobsInHistory == 0 {
 		t.KeepSuccessJobsInHistory = boptions.DefaultOptions.KeepSuccessJobsInHistory
@@ -214,6 +287,108 @@ func (t *BeanqConfig) init() {
 	}
 }
 
+// redisConnection the name of the connection the stream of channel and topic lives on, empty for Redis
+func (t *BeanqConfig) redisConnection(channel, topic string) string {
+	for _, route := range t.RedisRoutes {
+		if route.match(channel, topic) {
+			return route.Connection
+		}
+	}
+	return ""
+}
+
+func (t *BeanqConfig) checkHistory() error {
+	switch t.History.Overflow {
+	case "", LogOverflowDrop:
+	case LogOverflowSpill:
+		if t.History.SpillDir == "" {
+			return fmt.Errorf("history overflow %s: spillDir is empty", LogOverflowSpill)
+		}
+	default:
+		return fmt.Errorf("history overflow %q: want %s or %s", t.History.Overflow, LogOverflowDrop, LogOverflowSpill)
+	}
+	return nil
+}
+
+func (t *BeanqConfig) checkRedisRoutes() error {
+	for _, route := range t.RedisRoutes {
+		if _, ok := t.RedisConnections[route.Connection]; !ok {
+			return fmt.Errorf("redis route %s/%s: no connection named %q", route.Channel, route.Topic, route.Connection)
+		}
+		for _, pattern := range []string{route.Channel, route.Topic} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("redis route %s/%s: %w", route.Channel, route.Topic, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t RedisRoute) match(channel, topic string) bool {
+	return matchPattern(t.Channel, channel) && matchPattern(t.Topic, topic)
+}
+
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// options the connection settings of NewRdb besides the address and the pool
+func (t *Redis) options() (bredis.Options, error) {
+	tlsConfig := t.TLSConfig
+	if tlsConfig == nil && t.TLS.On {
+		var err error
+		if tlsConfig, err = t.TLS.config(); err != nil {
+			return bredis.Options{}, err
+		}
+	}
+
+	return bredis.Options{
+		Username:         t.Username,
+		MasterName:       t.MasterName,
+		SentinelUsername: t.SentinelUsername,
+		SentinelPassword: t.SentinelPassword,
+		TLSConfig:        tlsConfig,
+	}, nil
+}
+
+func (t *RedisTLS) config() (*tls.Config, error) {
+	//nolint:gosec // skipping the verification is an explicit choice of the config
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis tls ca: no certificate in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("redis tls: certFile and keyFile go together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("redis tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
 func (t *BeanqConfig) ToJson() string {
 
 	bt, err := json.Marshal(t)
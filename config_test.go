@@ -1,8 +1,18 @@
 package beanq
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -72,3 +82,112 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestRedisTLS_config(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	redis := Redis{Username: "beanq", MasterName: "mymaster", TLS: RedisTLS{On: true, CAFile: certFile, CertFile: certFile, KeyFile: keyFile, ServerName: "redis"}}
+	options, err := redis.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.TLSConfig == nil || options.TLSConfig.RootCAs == nil || len(options.TLSConfig.Certificates) != 1 || options.TLSConfig.ServerName != "redis" {
+		t.Errorf("Expected the CA and the client certificate to be loaded, got: %+v", options.TLSConfig)
+	}
+	if options.Username != "beanq" || options.MasterName != "mymaster" {
+		t.Errorf("Expected the ACL user and the sentinel master, got: %+v", options)
+	}
+
+	redis.TLS.KeyFile = ""
+	if _, err := redis.options(); err == nil {
+		t.Error("Expected an error for a certificate without its key")
+	}
+	redis.TLS.On = false
+	if options, err := redis.options(); err != nil || options.TLSConfig != nil {
+		t.Errorf("Expected no TLS, got: %+v %v", options.TLSConfig, err)
+	}
+}
+
+func TestBeanqConfig_redisConnection(t *testing.T) {
+	cfg := BeanqConfig{
+		RedisConnections: map[string]Redis{"analytics": {}, "payment": {}},
+		RedisRoutes: []RedisRoute{
+			{Channel: "payment", Topic: "refund-*", Connection: "payment"},
+			{Channel: "analytics", Connection: "analytics"},
+			{Channel: "*", Topic: "track-*", Connection: "analytics"},
+		},
+	}
+	if err := cfg.checkRedisRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		channel, topic, expected string
+	}{
+		{"payment", "refund-card", "payment"},
+		{"payment", "charge", ""},
+		{"analytics", "page-view", "analytics"},
+		{"order", "track-open", "analytics"},
+		{"order", "create", ""},
+	}
+	for _, tt := range tests {
+		if got := cfg.redisConnection(tt.channel, tt.topic); got != tt.expected {
+			t.Errorf("%s/%s: expected %q, got %q", tt.channel, tt.topic, tt.expected, got)
+		}
+	}
+
+	cfg.RedisRoutes = append(cfg.RedisRoutes, RedisRoute{Channel: "audit", Connection: "missing"})
+	if err := cfg.checkRedisRoutes(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected an error for the unknown connection, got: %v", err)
+	}
+	cfg.RedisRoutes = []RedisRoute{{Channel: "[", Connection: "payment"}}
+	if err := cfg.checkRedisRoutes(); err == nil {
+		t.Error("Expected an error for the malformed pattern")
+	}
+}
+
+func TestBeanqConfig_checkHistory(t *testing.T) {
+	tests := []struct {
+		history History
+		valid   bool
+	}{
+		{History{}, true},
+		{History{Overflow: LogOverflowDrop}, true},
+		{History{Overflow: LogOverflowSpill, SpillDir: "/var/lib/beanq/spill"}, true},
+		{History{Overflow: LogOverflowSpill}, false},
+		{History{Overflow: "block"}, false},
+	}
+	for _, tt := range tests {
+		cfg := BeanqConfig{History: tt.history}
+		if err := cfg.checkHistory(); (err == nil) != tt.valid {
+			t.Errorf("%+v: expected valid %v, got: %v", tt.history, tt.valid, err)
+		}
+	}
+}
@@ -45,6 +45,7 @@ func main() {
 	config := initCnf()
 	ctx := context.Background()
 	csm := beanq.New(&config)
+	defer csm.Close()
 
 	// register delay consumer
 
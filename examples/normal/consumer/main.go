@@ -45,6 +45,7 @@ func initCnf() *beanq.BeanqConfig {
 func main() {
 	config := initCnf()
 	csm := beanq.New(config)
+	defer csm.Close()
 
 	// register delay consumer
 	ctx := context.Background()
@@ -45,6 +45,7 @@ func initCnf() *beanq.BeanqConfig {
 func main() {
 	config := initCnf()
 	csm := beanq.New(config)
+	defer csm.Close()
 	_, _ = csm.BQ().SubscribeToSequence("delay-channel", "order-topic", beanq.DefaultHandle{
 		DoHandle: func(ctx context.Context, message *beanq.Message) error {
 			fmt.Printf("---%+v \n", message)
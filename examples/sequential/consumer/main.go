@@ -73,6 +73,7 @@ var ErrorSkip = errors.New("SKIP ERROR")
 func main() {
 	config := initCnf()
 	csm := beanq.New(config)
+	defer csm.Close()
 	beanq.InitWorkflow(config)
 
 	ctx := context.Background()
@@ -36,7 +36,7 @@ type BMongo struct {
 	tenantCollection   string
 }
 
-func createCollection(ctx context.Context) error {
+func createCollection(ctx context.Context, mgo *BMongo) error {
 
 	//event log
 	event := Collection(mgo.eventCollection)
@@ -82,6 +82,7 @@ func createCollection(ctx context.Context) error {
 	return nil
 }
 
+// NewMongo the mongo shared by the process, it's connected by the first call
 func NewMongo(host, port string,
 	username, password string,
 	database string,
@@ -89,69 +90,85 @@ func NewMongo(host, port string,
 	connectTimeOut time.Duration, maxConnectionPoolSize uint64,
 	maxConnectionLifeTime time.Duration) *BMongo {
 	mongoOnce.Do(func() {
+		mgo = Connect(host, port, username, password, database, collections, connectTimeOut, maxConnectionPoolSize, maxConnectionLifeTime)
+	})
+	return mgo
+}
 
-		port = strings.TrimLeft(port, ":")
-		port = fmt.Sprintf(":%s", port)
-		uri := strings.Join([]string{"mongodb://", host, port}, "")
-
-		opts := options.Client().ApplyURI(uri).
-			SetConnectTimeout(connectTimeOut).
-			SetMaxPoolSize(maxConnectionPoolSize).
-			SetMaxConnIdleTime(maxConnectionLifeTime)
-
-		if username != "" && password != "" {
-			auth := options.Credential{
-				AuthSource: database,
-				Username:   username,
-				Password:   password,
-			}
-			opts.SetAuth(auth)
-		}
+// Connect a mongo of its own, the caller closes it by Close
+func Connect(host, port string,
+	username, password string,
+	database string,
+	collections map[string]string,
+	connectTimeOut time.Duration, maxConnectionPoolSize uint64,
+	maxConnectionLifeTime time.Duration) *BMongo {
 
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
+	port = strings.TrimLeft(port, ":")
+	port = fmt.Sprintf(":%s", port)
+	uri := strings.Join([]string{"mongodb://", host, port}, "")
 
-		client, err := mongo.Connect(ctx, opts)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if err := client.Ping(ctx, nil); err != nil {
-			log.Fatal(err)
-		}
+	opts := options.Client().ApplyURI(uri).
+		SetConnectTimeout(connectTimeOut).
+		SetMaxPoolSize(maxConnectionPoolSize).
+		SetMaxConnIdleTime(maxConnectionLifeTime)
 
-		mgo = &BMongo{
-			database:           client.Database(database),
-			eventCollection:    "event_logs",
-			workflowCollection: "workflow_logs",
-			managerCollection:  "managers",
-			optCollection:      "opt_logs",
-			roleCollection:     "roles",
-			tenantCollection:   "tenants",
-		}
-		if v, ok := collections["event"]; ok {
-			mgo.eventCollection = v
-		}
-		if v, ok := collections["workflow"]; ok {
-			mgo.workflowCollection = v
-		}
-		if v, ok := collections["manager"]; ok {
-			mgo.managerCollection = v
-		}
-		if v, ok := collections["opt"]; ok {
-			mgo.optCollection = v
-		}
-		if v, ok := collections["roles"]; ok {
-			mgo.roleCollection = v
-		}
-		if v, ok := collections["tenant"]; ok {
-			mgo.tenantCollection = v
-		}
-		mgo.configCollection = "config"
-		if err := createCollection(ctx); err != nil {
-			log.Fatal(err)
+	if username != "" && password != "" {
+		auth := options.Credential{
+			AuthSource: database,
+			Username:   username,
+			Password:   password,
 		}
-	})
-	return mgo
+		opts.SetAuth(auth)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		log.Fatal(err)
+	}
+
+	m := &BMongo{
+		database:           client.Database(database),
+		eventCollection:    "event_logs",
+		workflowCollection: "workflow_logs",
+		managerCollection:  "managers",
+		optCollection:      "opt_logs",
+		roleCollection:     "roles",
+		tenantCollection:   "tenants",
+	}
+	if v, ok := collections["event"]; ok {
+		m.eventCollection = v
+	}
+	if v, ok := collections["workflow"]; ok {
+		m.workflowCollection = v
+	}
+	if v, ok := collections["manager"]; ok {
+		m.managerCollection = v
+	}
+	if v, ok := collections["opt"]; ok {
+		m.optCollection = v
+	}
+	if v, ok := collections["roles"]; ok {
+		m.roleCollection = v
+	}
+	if v, ok := collections["tenant"]; ok {
+		m.tenantCollection = v
+	}
+	m.configCollection = "config"
+	if err := createCollection(ctx, m); err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// Close disconnect a mongo returned by Connect
+func (t *BMongo) Close(ctx context.Context) error {
+	return t.database.Client().Disconnect(ctx)
 }
 
 func (t *BMongo) DocumentCount(ctx context.Context, status string) (int64, error) {
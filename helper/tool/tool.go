@@ -54,6 +54,29 @@ func MakeStreamKey(subType btype.SubscribeType, prefix, channel, topic string) s
 	return makeKey(prefix, channel, topic, stream, "stream")
 }
 
+// MakePriorityStreamKey create key for one priority lane of a stream,
+// lane 0 is the plain stream so a single lane keeps the original key
+func MakePriorityStreamKey(subType btype.SubscribeType, prefix, channel, topic string, lane int) string {
+	streamKey := MakeStreamKey(subType, prefix, channel, topic)
+	if lane <= 0 {
+		return streamKey
+	}
+	streamKey = strings.TrimSuffix(streamKey, ":stream")
+	return makeKey(streamKey, "p"+cast.ToString(lane), "stream")
+}
+
+// PriorityLane map a priority in [0,999] onto one of lanes, the higher the priority the higher the lane
+func PriorityLane(priority float64, lanes int) int {
+	if lanes <= 1 || priority <= 0 {
+		return 0
+	}
+	lane := int(priority * float64(lanes) / 1000)
+	if lane >= lanes {
+		lane = lanes - 1
+	}
+	return lane
+}
+
 // MakeStatusKey create key for type string
 func MakeStatusKey(prefix, channel, topic, id string) string {
 	channel = strings.Join([]string{"{", channel}, "")
@@ -74,6 +97,41 @@ func MakeSequenceDataKey(prefix, channel, topic, id string) string {
 	return makeKey(prefix, channel, topic, "order", id)
 }
 
+// MakeDedupKey create key for the publish deduplication window,
+// it shares the hash slot with the stream and zset of the topic
+func MakeDedupKey(prefix, channel, topic, key string) string {
+	if channel == "" {
+		channel = boptions.DefaultOptions.DefaultChannel
+	}
+	if topic == "" {
+		topic = boptions.DefaultOptions.DefaultTopic
+	}
+	channel = strings.Join([]string{"{", channel}, "")
+	topic = strings.Join([]string{topic, "}"}, "")
+	return makeKey(prefix, channel, topic, "dedup", key)
+}
+
+// MakeCollapseKey create key for debounce and throttle publishing,
+// it shares the hash slot with the zset of the topic
+func MakeCollapseKey(prefix, channel, topic, mode, key string) string {
+	if channel == "" {
+		channel = boptions.DefaultOptions.DefaultChannel
+	}
+	if topic == "" {
+		topic = boptions.DefaultOptions.DefaultTopic
+	}
+	channel = strings.Join([]string{"{", channel}, "")
+	topic = strings.Join([]string{topic, "}"}, "")
+	return makeKey(prefix, channel, topic, mode, key)
+}
+
+// MakeProcessedKey create key for a message which has been handled by the consumer
+func MakeProcessedKey(prefix, channel, topic, id string) string {
+	channel = strings.Join([]string{"{", channel}, "")
+	topic = strings.Join([]string{topic, "}"}, "")
+	return makeKey(prefix, channel, topic, "processed", id)
+}
+
 // MakeDynamicKey create key for dynamic
 func MakeDynamicKey(prefix, channel string) string {
 	if channel == "" {
@@ -102,6 +160,17 @@ func MakeLogicKey(prefix string) string {
 	return makeKey(prefix, "beanq-logic-log")
 }
 
+// MakeLogicTrimmedKey create key for the count of logic log entries trimmed before migrated,
+// the whole logic key is its hash tag so it shares the hash slot with the log
+func MakeLogicTrimmedKey(prefix string) string {
+	return strings.Join([]string{"{", MakeLogicKey(prefix), "}:trimmed"}, "")
+}
+
+// MakeDeadLetterReclaimedKey create key for the count of pending messages reclaimed as dead letters
+func MakeDeadLetterReclaimedKey(prefix string) string {
+	return makeKey(prefix, "dead-letter-reclaimed")
+}
+
 // RetryInfo retry=0 means no retries, but it will be executed at least once.
 func RetryInfo(ctx context.Context, f func() error, retry int, matcher ...func(error) bool) (i int, err error) {
 	for i = 0; i <= retry; i++ {
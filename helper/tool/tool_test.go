@@ -0,0 +1,53 @@
+package tool
+
+import (
+	"testing"
+
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+)
+
+func TestPriorityLane(t *testing.T) {
+	tests := []struct {
+		priority float64
+		lanes    int
+		expected int
+	}{
+		{500, 1, 0},
+		{500, 0, 0},
+		{0, 3, 0},
+		{-5, 3, 0},
+		{332, 3, 0},
+		{334, 3, 1},
+		{666, 3, 1},
+		{667, 3, 2},
+		{999, 3, 2},
+		{1000, 3, 2},
+		{5000, 3, 2},
+		{999, 10, 9},
+		{99, 10, 0},
+		{100, 10, 1},
+	}
+	for _, tt := range tests {
+		if got := PriorityLane(tt.priority, tt.lanes); got != tt.expected {
+			t.Errorf("PriorityLane(%v, %d): expected %d, got %d", tt.priority, tt.lanes, tt.expected, got)
+		}
+	}
+}
+
+func TestMakePriorityStreamKey(t *testing.T) {
+	stream := MakeStreamKey(btype.NormalSubscribe, "beanq", "ch", "tp")
+	tests := []struct {
+		lane     int
+		expected string
+	}{
+		{-1, stream},
+		{0, stream},
+		{1, "beanq:{ch:tp}:normal_stream:p1:stream"},
+		{2, "beanq:{ch:tp}:normal_stream:p2:stream"},
+	}
+	for _, tt := range tests {
+		if got := MakePriorityStreamKey(btype.NormalSubscribe, "beanq", "ch", "tp", tt.lane); got != tt.expected {
+			t.Errorf("lane %d: expected %q, got %q", tt.lane, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryIdempotent keeps the claims in memory
+type memoryIdempotent struct {
+	mu     sync.Mutex
+	claims map[string]string
+}
+
+func (m *memoryIdempotent) Claim(ctx context.Context, channel, topic, id, token string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.claims[id]; ok {
+		return false, nil
+	}
+	m.claims[id] = token
+	return true, nil
+}
+
+func (m *memoryIdempotent) Done(ctx context.Context, channel, topic, id, token string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claims[id] == token {
+		m.claims[id] = "done"
+	}
+	return nil
+}
+
+func (m *memoryIdempotent) Release(ctx context.Context, channel, topic, id, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.claims[id] == token {
+		delete(m.claims, id)
+	}
+	return nil
+}
+
+func TestHandler_withIdempotency(t *testing.T) {
+	h := &Handler{idempotent: &memoryIdempotent{claims: map[string]string{}}, idempotency: time.Hour}
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := h.withIdempotency(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		calls.Add(1)
+		<-release
+		return 0, nil
+	})
+
+	// two redeliveries of the same message at once
+	var wait sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if _, err := slow(ctx, map[string]any{"id": "1"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wait.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("Expected the handler to run once, got: %d", calls.Load())
+	}
+	_, _ = slow(ctx, map[string]any{"id": "1"})
+	if calls.Load() != 1 {
+		t.Errorf("Expected the handled message to be skipped, got: %d calls", calls.Load())
+	}
+
+	failed := errors.New("failed")
+	fail := h.withIdempotency(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		calls.Add(1)
+		return 0, failed
+	})
+	if _, err := fail(ctx, map[string]any{"id": "2"}); !errors.Is(err, failed) {
+		t.Fatalf("Expected the handler error, got: %v", err)
+	}
+	_, _ = fail(ctx, map[string]any{"id": "2"})
+	if calls.Load() != 3 {
+		t.Errorf("Expected a failed message to be handled again, got: %d calls", calls.Load())
+	}
+
+	_, _ = slow(ctx, map[string]any{})
+	if calls.Load() != 4 {
+		t.Errorf("Expected a message without id to be handled, got: %d calls", calls.Load())
+	}
+}
+
+func TestHandler_withIdempotency_off(t *testing.T) {
+	h := &Handler{idempotent: &memoryIdempotent{claims: map[string]string{}}}
+	var calls int
+	do := h.withIdempotency(func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+		calls++
+		return 0, nil
+	})
+	for i := 0; i < 2; i++ {
+		_, _ = do(context.Background(), map[string]any{"id": "1"})
+	}
+	if calls != 2 {
+		t.Errorf("Expected no idempotency without a ttl, got: %d calls", calls)
+	}
+}
@@ -2,6 +2,7 @@ package public
 
 import (
 	"context"
+	"time"
 
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 	"github.com/retail-ai-inc/beanq/v4/internal/btype"
@@ -48,6 +49,13 @@ type IStatus interface {
 	Status(ctx context.Context, channel, topic, id string, isOrder bool) (map[string]string, error)
 }
 
+// IIdempotent claim a message before handling it and remember it once it has been handled successfully
+type IIdempotent interface {
+	Claim(ctx context.Context, channel, topic, id, token string, ttl time.Duration) (bool, error)
+	Done(ctx context.Context, channel, topic, id, token string, ttl time.Duration) error
+	Release(ctx context.Context, channel, topic, id, token string) error
+}
+
 func (CallbackWithRetry) Error(ctx context.Context, err error) {
 	if err != nil {
 		logger.New().Error(err)
@@ -40,12 +40,16 @@ type Options struct {
 	DefaultChannel           string
 	Prefix                   string
 	ConsumerPoolSize         int
+	PriorityLanes            int
+	PriorityStarvation       int
 	Priority                 float64
 	JobMaxRetry              int
 	DefaultMaxLen            int64
 	MinConsumers             int64
 	DeadLetterIdle           time.Duration
 	DeadLetterTicker         time.Duration
+	DeadLetterBatch          int64
+	LogMaxLen                int64
 	TimeToRun                time.Duration
 	KeepSuccessJobsInHistory time.Duration
 	KeepFailedJobsInHistory  time.Duration
@@ -57,6 +61,8 @@ type Options struct {
 var DefaultOptions = &Options{
 	DeadLetterIdle:           time.Second * 60,
 	DeadLetterTicker:         time.Second * 5,
+	DeadLetterBatch:          100,
+	LogMaxLen:                20000,
 	KeepFailedJobsInHistory:  time.Hour * 24 * 7,
 	KeepSuccessJobsInHistory: time.Hour * 24 * 7,
 	PublishTimeOut:           10 * time.Second,
@@ -72,6 +78,9 @@ var DefaultOptions = &Options{
 	DefaultChannel: "default-channel",
 	DefaultMaxLen:  2000,
 
+	PriorityLanes:      1,
+	PriorityStarvation: 10,
+
 	OrderKey: "",
 
 	DefaultDelayTopic:   "default-delay-topic",
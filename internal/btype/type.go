@@ -27,3 +27,19 @@ const (
 	SEQUENCE         MoodType = "sequential"
 	SEQUENCE_BY_LOCK MoodType = "sequential_by_lock"
 )
+
+// CollapseMode how the delay messages with the same key are merged
+type CollapseMode string
+
+func (m CollapseMode) String() string {
+	return string(m)
+}
+
+func (m CollapseMode) MarshalBinary() ([]byte, error) {
+	return []byte(m), nil
+}
+
+const (
+	DEBOUNCE CollapseMode = "debounce"
+	THROTTLE CollapseMode = "throttle"
+)
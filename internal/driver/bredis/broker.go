@@ -23,12 +23,18 @@ import (
 )
 
 type RdbBroker struct {
-	client           redis.UniversalClient
-	prefix           string
-	maxLen           int64
-	consumers        int64
-	consumerPoolSize int
-	deadLetterIdle   time.Duration
+	client             redis.UniversalClient
+	prefix             string
+	maxLen             int64
+	consumers          int64
+	consumerPoolSize   int
+	priorityLanes      int
+	priorityStarvation int
+	deadLetterIdle     time.Duration
+	deadLetterTicker   time.Duration
+	deadLetterBatch    int64
+	logMaxLen          int64
+	logMigrated        bool
 }
 
 func NewBroker(client redis.UniversalClient, prefix string, maxLen, consumers int64, consumerPoolSize int, duration time.Duration) *RdbBroker {
@@ -42,6 +48,33 @@ func NewBroker(client redis.UniversalClient, prefix string, maxLen, consumers in
 	}
 }
 
+// SetPriorityLanes split normal topics into `lanes` streams by priority,
+// see priorityLanes for the meaning of `starvation`
+func (t *RdbBroker) SetPriorityLanes(lanes, starvation int) *RdbBroker {
+	t.priorityLanes = lanes
+	t.priorityStarvation = starvation
+	return t
+}
+
+// SetDeadLetter reclaim the idle pending messages every `ticker`, `batch` of them per XAUTOCLAIM
+func (t *RdbBroker) SetDeadLetter(ticker time.Duration, batch int64) *RdbBroker {
+	t.deadLetterTicker = ticker
+	t.deadLetterBatch = batch
+	return t
+}
+
+// SetLogMaxLen trim the logic log to about `maxLen` entries
+func (t *RdbBroker) SetLogMaxLen(maxLen int64) *RdbBroker {
+	t.logMaxLen = maxLen
+	return t
+}
+
+// SetLogMigrated count the logic log entries trimmed before they are migrated, see ProcessLog.SetMigrated
+func (t *RdbBroker) SetLogMigrated(migrated bool) *RdbBroker {
+	t.logMigrated = migrated
+	return t
+}
+
 //func (t *RdbBroker) Migrate(ctx context.Context, log public.IMigrateLog) error {
 //	migrate := NewLog(t.client, t.prefix)
 //	return migrate.Migrate(ctx, log)
@@ -49,16 +82,29 @@ func NewBroker(client redis.UniversalClient, prefix string, maxLen, consumers in
 
 func (t *RdbBroker) Mood(moodType btype.MoodType, config *capture.Config) public.IBroker {
 	if moodType == btype.NORMAL {
-		return NewNormal(t.client, t.prefix, t.maxLen, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		normal := NewNormal(t.client, t.prefix, t.maxLen, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config).
+			SetPriorityLanes(t.priorityLanes, t.priorityStarvation)
+		normal.base.setDeadLetter(t.deadLetterTicker, t.deadLetterBatch)
+		normal.base.setLogicLog(t.logMaxLen, t.logMigrated)
+		return normal
 	}
 	if moodType == btype.SEQUENCE {
-		return NewSequence(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		sequence := NewSequence(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		sequence.base.setDeadLetter(t.deadLetterTicker, t.deadLetterBatch)
+		sequence.base.setLogicLog(t.logMaxLen, t.logMigrated)
+		return sequence
 	}
 	if moodType == btype.DELAY {
-		return NewSchedule(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		schedule := NewSchedule(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		schedule.base.setDeadLetter(t.deadLetterTicker, t.deadLetterBatch)
+		schedule.base.setLogicLog(t.logMaxLen, t.logMigrated)
+		return schedule
 	}
 	if moodType == btype.SEQUENCE_BY_LOCK {
-		return NewSequenceByLock(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		sequenceByLock := NewSequenceByLock(t.client, t.prefix, t.consumers, t.consumerPoolSize, t.deadLetterIdle, config)
+		sequenceByLock.base.setDeadLetter(t.deadLetterTicker, t.deadLetterBatch)
+		sequenceByLock.base.setLogicLog(t.logMaxLen, t.logMigrated)
+		return sequenceByLock
 	}
 	return nil
 }
@@ -72,9 +118,16 @@ type (
 		prefix           string
 		subType          btype.SubscribeType
 		deadLetterIdle   time.Duration
+		deadLetterTicker time.Duration
+		deadLetterBatch  int64
+		logMaxLen        int64
+		logMigrated      bool
 		consumers        int64
 		consumerPoolSize int
 		captureConfig    *capture.Config
+		// priority lanes, only used by normal messages for now
+		lanes      int
+		starvation int
 	}
 )
 
@@ -85,59 +138,108 @@ var DefaultBlockDuration BlockDuration = func() time.Duration {
 
 func (t *Base) DeadLetter(ctx context.Context, channel, topic string) {
 	streamKey := tool.MakeStreamKey(t.subType, t.prefix, channel, topic)
-	logicKey := tool.MakeLogicKey(t.prefix)
-	deadLetterKey := strings.Join([]string{streamKey, "dead_letter_lock"}, ":")
+	t.deadLetter(ctx, channel, topic, streamKey)
+}
 
-	ticker := time.NewTicker(DefaultBlockDuration())
-	defer ticker.Stop()
+// setDeadLetter reclaim the idle pending messages every `ticker`, `batch` of them at a time
+func (t *Base) setDeadLetter(ticker time.Duration, batch int64) {
+	t.deadLetterTicker = ticker
+	t.deadLetterBatch = batch
+}
 
-	deadLetterIdleTime := t.deadLetterIdle
+// deadLetter reclaim the pending messages of `streamKey` which have been idle for deadLetterIdle,
+// whichever consumer of the group has read them.
+func (t *Base) deadLetter(ctx context.Context, channel, topic, streamKey string) {
+	deadLetterKey := strings.Join([]string{streamKey, "dead_letter_lock"}, ":")
 
-	for range ticker.C {
+	interval := t.deadLetterTicker
+	if interval <= 0 {
+		interval = DefaultBlockDuration()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
+	for {
 		select {
 		case <-ctx.Done():
-			_ = t.client.Close()
 			return
-		default:
+		case <-ticker.C:
 		}
 
 		if v := AddLogicLockScript.Run(ctx, t.client, []string{deadLetterKey}).Val(); cast.ToInt64(v) == 1 {
 			continue
 		}
 
-		pendings := t.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		reclaimed, err := t.reclaim(ctx, channel, streamKey)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			capture.Dlq.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
+			logger.New().Error(err)
+		}
+		if reclaimed > 0 {
+			logger.New().Info("Channel:[", channel, "]Topic:[", topic, "] reclaimed ", reclaimed, " dead letter messages")
+		}
+
+		//Replace `Del` with `Unlink` and hand it over to the Redis server for processing.
+		if err := t.client.Unlink(ctx, deadLetterKey).Err(); err != nil {
+			capture.Dlq.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
+			logger.New().Error(err)
+		}
+	}
+}
+
+// reclaim walk the whole pending list of the group in batches, returns how many messages have been reclaimed
+func (t *Base) reclaim(ctx context.Context, channel, streamKey string) (int, error) {
+	batch := t.deadLetterBatch
+	if batch <= 0 {
+		batch = 100
+	}
+
+	var (
+		reclaimed int
+		start     = "0-0"
+	)
+	for {
+		next, messages, err := xAutoClaim(ctx, t.client, &redis.XAutoClaimArgs{
 			Stream:   streamKey,
 			Group:    channel,
-			Consumer: streamKey,
-			Start:    "-",
-			End:      "+",
-			Count:    1,
-		}).Val()
-		length := len(pendings)
-		if length <= 0 {
-			//Replace `Del` with `Unlink` and hand it over to the Redis server for processing.
-			if err := t.client.Unlink(ctx, deadLetterKey).Err(); err != nil {
-				capture.Dlq.When(t.captureConfig).If(&capture.Channel{
-					Channel: channel,
-					Topic:   []string{},
-				}).Then(err)
-				logger.New().Error(err)
-			}
-			continue
+			Consumer: deadLetterConsumer,
+			MinIdle:  t.deadLetterIdle,
+			Start:    start,
+			Count:    batch,
+		})
+		if err != nil {
+			return reclaimed, err
 		}
 
-		pending := pendings[0]
+		if len(messages) > 0 {
+			if err := t.deadLetterBatchDone(ctx, streamKey, channel, messages); err != nil {
+				return reclaimed, err
+			}
+			reclaimed += len(messages)
+		}
 
-		if pending.Idle > deadLetterIdleTime {
+		if next == "0-0" || next == "" {
+			return reclaimed, nil
+		}
+		start = next
+	}
+}
 
-			rangeV := t.client.XRange(ctx, streamKey, pending.ID, pending.ID).Val()
+// deadLetterBatchDone publish the claimed messages again when they have never been received,
+// log the others as dead letters, and remove all of them from the stream in one round trip,
+// counting them for the dashboard
+func (t *Base) deadLetterBatchDone(ctx context.Context, streamKey, channel string, messages []redis.XMessage) error {
+	logicKey := tool.MakeLogicKey(t.prefix)
 
-			if len(rangeV) <= 0 {
-				t.client.Unlink(ctx, deadLetterKey)
+	ids := make([]string, 0, len(messages))
+	_, err := t.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+			val := message.Values
+			// the entry has been deleted from the stream, only its pending entry is left
+			if len(val) == 0 {
 				continue
 			}
-			val := rangeV[0].Values
 			val["logType"] = bstatus.Dlq
 
 			// logic XAddArgs
@@ -145,61 +247,128 @@ func (t *Base) DeadLetter(ctx context.Context, channel, topic string) {
 				Stream: logicKey,
 				Values: val,
 			}
-
-			if v, ok := val["status"]; ok {
-				if v.(string) == bstatus.StatusPublished {
-					//  TODO:Re-enter the queue
-					var maxLenInt int64 = 200000
-					if maxLen, ok := val["maxLen"]; ok {
-						ml := cast.ToInt64(maxLen)
-						if ml > 0 {
-							maxLenInt = ml
-						}
+			if v, ok := val["status"]; ok && cast.ToString(v) == bstatus.StatusPublished {
+				var maxLenInt int64 = 200000
+				if maxLen, ok := val["maxLen"]; ok {
+					if ml := cast.ToInt64(maxLen); ml > 0 {
+						maxLenInt = ml
 					}
-					// normal message XAddArgs
-					// Need to handle idempotent keys
-					args = NewZAddArgs(streamKey, "", "*", maxLenInt, 0, val)
 				}
+				// never received, re-enter the queue
+				args = NewZAddArgs(streamKey, "", "*", maxLenInt, 0, val)
 			}
-			if err := t.client.XAdd(ctx, args).Err(); err != nil {
-				capture.Dlq.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{}}).Then(err)
-				logger.New().Error(err)
-			}
+			pipeliner.XAdd(ctx, args)
 		}
-
-		if _, err := t.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
-			pipeliner.XAck(ctx, streamKey, channel, pending.ID)
-			pipeliner.XDel(ctx, streamKey, pending.ID)
-			return nil
-		}); err != nil {
-			capture.Dlq.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{}}).Then(err)
-			logger.New().Error(err)
-		}
-		if err := t.client.Unlink(ctx, deadLetterKey).Err(); err != nil {
-			capture.Dlq.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{}}).Then(err)
-			logger.New().Error(err)
-		}
-	}
+		pipeliner.XAck(ctx, streamKey, channel, ids...)
+		pipeliner.XDel(ctx, streamKey, ids...)
+		pipeliner.HIncrBy(ctx, tool.MakeDeadLetterReclaimedKey(t.prefix), "total", int64(len(ids)))
+		return nil
+	})
+	return err
 }
 
 func (t *Base) Enqueue(_ context.Context, _ map[string]any) error {
 	return nil
 }
 
+// logicLogMaxLen the length the logic log is trimmed to about by default
+const logicLogMaxLen int64 = 20000
+
+// setLogicLog trim the logic log to about `maxLen` entries, in the enqueue scripts and AddLog alike,
+// and count the trimmed entries when the log is migrated
+func (t *Base) setLogicLog(maxLen int64, migrated bool) {
+	t.logMaxLen = maxLen
+	t.logMigrated = migrated
+	t.IProcessLog = NewProcessLog(t.client, t.prefix).SetMaxLen(maxLen).SetMigrated(migrated)
+}
+
+// publishKeys append the logic log and its trimmed counter to the keys of an enqueue script
+// and return the length the script trims the log to, the scripts take it and logMigrated first.
+// The logic log has no hash tag, a cluster can't write it in the script of a queue,
+// so no log key is passed and the log is added by publishedLog afterwards:
+// there a publish isn't atomic and a failed log write isn't returned, see Redis Cluster in the README.
+func (t *Base) publishKeys(keys ...string) ([]string, int64) {
+	if _, ok := t.client.(*redis.ClusterClient); ok {
+		return keys, 0
+	}
+	maxLen := t.logMaxLen
+	if maxLen <= 0 {
+		maxLen = logicLogMaxLen
+	}
+	return append(keys, tool.MakeLogicKey(t.prefix), tool.MakeLogicTrimmedKey(t.prefix)), maxLen
+}
+
+// publishedLog add the published log the enqueue script left to the caller,
+// the message is queued by then so a failure is reported instead of returned.
+func (t *Base) publishedLog(ctx context.Context, logMaxLen int64, data map[string]any) {
+	if logMaxLen > 0 {
+		return
+	}
+	data["status"] = bstatus.StatusPublished
+	if err := t.AddLog(ctx, data); err != nil {
+		logger.New().Error(err)
+		capture.System.When(t.captureConfig).If(&capture.Channel{Channel: cast.ToString(data["channel"]), Topic: []string{cast.ToString(data["topic"])}}).Then(err)
+	}
+}
+
 func (t *Base) Dequeue(ctx context.Context, channel, topic string, do public.CallbackWithRetry) {
 
 	streamKey := tool.MakeStreamKey(t.subType, t.prefix, channel, topic)
-	readGroupArgs := NewReadGroupArgs(channel, streamKey, []string{streamKey, ">"}, t.consumers, 500*time.Millisecond)
+	lanes := newPriorityLanes(t.subType, t.prefix, channel, topic, t.lanes, t.starvation)
 	// worker num
-	workerNum := t.consumerPoolSize
+	workerNum := max(t.consumerPoolSize, 1)
+
+	// a slot is taken for every message read and given back once the message is acked,
+	// so no more messages are read than the workers can start right away
+	slots := make(chan struct{}, workerNum)
+	for i := 0; i < workerNum; i++ {
+		slots <- struct{}{}
+	}
+	jobs := make(chan public.Stream, workerNum)
+
+	// long-lived workers, a slow message only holds its own worker
+	var wait sync.WaitGroup
+	for i := 0; i < workerNum; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			worker(ctx, jobs, do, t.captureConfig, func(result public.Stream) {
+				t.ack(ctx, channel, topic, result)
+				slots <- struct{}{}
+			})
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wait.Wait()
+	}()
 
 	for {
 
-		cmd := t.client.XReadGroup(ctx, readGroupArgs)
-		if err := cmd.Err(); err != nil {
+		count := takeSlots(ctx, slots, max(t.consumers, 1))
+		if count == 0 {
+			logger.New().Info("Channel:[", channel, "]Topic:[", topic, "] Task Stop")
+			return
+		}
 
+		var (
+			streams []redis.XStream
+			err     error
+		)
+		if lanes != nil {
+			streams, err = lanes.read(ctx, t.client, channel, streamKey, count, 500*time.Millisecond)
+		} else {
+			streams, err = t.client.XReadGroup(ctx, NewReadGroupArgs(channel, streamKey, []string{streamKey, ">"}, count, 500*time.Millisecond)).Result()
+		}
+		if err != nil {
+
+			giveSlots(slots, count)
 			if strings.Contains(err.Error(), "NOGROUP No such key") {
-				if err := t.client.XGroupCreateMkStream(ctx, streamKey, channel, "0").Err(); err != nil {
+				keys := []string{streamKey}
+				if lanes != nil {
+					keys = lanes.keys
+				}
+				if err := t.createGroup(ctx, channel, keys...); err != nil {
 					logger.New().Error(err)
 					return
 				}
@@ -207,73 +376,93 @@ func (t *Base) Dequeue(ctx context.Context, channel, topic string, do public.Cal
 			}
 
 			if errors.Is(err, context.Canceled) || errors.Is(err, redis.ErrClosed) {
-				_ = t.client.Close()
 				logger.New().Info("Channel:[", channel, "]Topic:[", topic, "] Task Stop")
 				return
 			}
-		}
-
-		streams := cmd.Val()
-		if len(streams) <= 0 {
 			continue
 		}
-		stream := streams[0].Stream
-		messages := streams[0].Messages
-
-		// Use Fan-Out mode to process tasks
-		var wait sync.WaitGroup
-		jobs, results := make(chan public.Stream, len(messages)), make(chan public.Stream, len(messages))
-		// start workers
-		for i := 0; i < workerNum; i++ {
-			wait.Add(1)
-			go worker(ctx, jobs, results, do, &wait, t.captureConfig)
-		}
-		// send jobs
-		for _, message := range messages {
-			jobs <- public.Stream{
-				Data:    message.Values,
-				Id:      message.ID,
-				Channel: channel,
-				Stream:  stream,
+
+		var read int64
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				read++
+				jobs <- public.Stream{
+					Data:    message.Values,
+					Id:      message.ID,
+					Channel: channel,
+					Stream:  stream.Stream,
+				}
 			}
 		}
-		close(jobs)
-		go func() {
-			wait.Wait()
-			close(results)
-		}()
-		// handler worker results
-		ids := make([]string, 0, len(messages))
-		for result := range results {
+		// give back the slots no message has been read for
+		giveSlots(slots, count-read)
+	}
+}
 
-			if orderKey, ok := result.Data["orderKey"]; ok {
-				orderRediKey := tool.MakeSequenceLockKey(t.prefix, channel, topic, cast.ToString(orderKey))
-				t.client.HDel(ctx, orderRediKey)
-			}
+// takeSlots wait for one free worker slot and take the other free ones, `limit` at most.
+// Returns 0 once ctx is done.
+func takeSlots(ctx context.Context, slots chan struct{}, limit int64) int64 {
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-slots:
+	}
+	count := int64(1)
+	for count < limit {
+		select {
+		case <-slots:
+			count++
+		default:
+			return count
+		}
+	}
+	return count
+}
 
-			if err := t.AddLog(ctx, result.Data); err != nil {
-				logger.New().Error(err)
-				capture.Fail.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
-				continue
-			}
-			ids = append(ids, result.Id)
+func giveSlots(slots chan struct{}, count int64) {
+	for ; count > 0; count-- {
+		slots <- struct{}{}
+	}
+}
 
-			_, err := t.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
-				pipeliner.XAck(ctx, stream, channel, ids...)
-				pipeliner.XDel(ctx, stream, ids...)
-				return nil
-			})
-			if err != nil {
-				logger.New().Error(err)
-				capture.Fail.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
-			}
+// ack log the result of the message and remove it from the stream
+func (t *Base) ack(ctx context.Context, channel, topic string, result public.Stream) {
+
+	if orderKey, ok := result.Data["orderKey"]; ok {
+		orderRediKey := tool.MakeSequenceLockKey(t.prefix, channel, topic, cast.ToString(orderKey))
+		t.client.HDel(ctx, orderRediKey)
+	}
+
+	if err := t.AddLog(ctx, result.Data); err != nil {
+		logger.New().Error(err)
+		capture.Fail.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
+		return
+	}
+
+	_, err := t.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.XAck(ctx, result.Stream, channel, result.Id)
+		pipeliner.XDel(ctx, result.Stream, result.Id)
+		return nil
+	})
+	if err != nil {
+		logger.New().Error(err)
+		capture.Fail.When(t.captureConfig).If(&capture.Channel{Channel: channel, Topic: []string{topic}}).Then(err)
+	}
+}
+
+// createGroup create the consumer group on every stream, an existing group is not an error
+func (t *Base) createGroup(ctx context.Context, group string, streamKeys ...string) error {
+	for _, key := range streamKeys {
+		err := t.client.XGroupCreateMkStream(ctx, key, group, "0").Err()
+		if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+			return err
 		}
 	}
+	return nil
 }
 
-// consumer worker
-func worker(ctx context.Context, jobs, result chan public.Stream, handler public.CallbackWithRetry, wg *sync.WaitGroup, config *capture.Config) {
-	defer wg.Done()
+// consumer worker, `done` is called with every handled message
+func worker(ctx context.Context, jobs <-chan public.Stream, handler public.CallbackWithRetry, config *capture.Config, done func(result public.Stream)) {
 
 	for {
 
@@ -365,7 +554,7 @@ func worker(ctx context.Context, jobs, result chan public.Stream, handler public
 			// `stream` confirmation message
 			cancel()
 			job.Data = val
-			result <- job
+			done(job)
 		}
 	}
 }
@@ -0,0 +1,120 @@
+package bredis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	public "github.com/retail-ai-inc/beanq/v4/internal"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+)
+
+// benchStream stands in for a stream which always has messages to read
+type benchStream struct {
+	redis.UniversalClient
+	seq atomic.Int64
+}
+
+func (s *benchStream) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	messages := make([]redis.XMessage, a.Count)
+	for i := range messages {
+		seq := s.seq.Add(1)
+		messages[i] = redis.XMessage{
+			ID:     strconv.FormatInt(seq, 10) + "-0",
+			Values: map[string]any{"seq": seq, "timeToRun": "1h"},
+		}
+	}
+	return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+}
+
+func (s *benchStream) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+// benchLog counts the acked messages
+type benchLog struct {
+	public.IProcessLog
+	acked atomic.Int64
+	done  chan struct{}
+	n     int64
+	once  sync.Once
+}
+
+func (l *benchLog) AddLog(ctx context.Context, data map[string]any) error {
+	if l.acked.Add(1) == l.n {
+		l.once.Do(func() { close(l.done) })
+	}
+	return nil
+}
+
+// latency one message in ten is slow
+func latency(data map[string]any) time.Duration {
+	if data["seq"].(int64)%10 == 0 {
+		return 20 * time.Millisecond
+	}
+	return 200 * time.Microsecond
+}
+
+func BenchmarkBase_Dequeue_MixedLatency(b *testing.B) {
+	benchmarkDequeue(b, latency)
+}
+
+func BenchmarkBase_Dequeue_UniformLatency(b *testing.B) {
+	benchmarkDequeue(b, func(map[string]any) time.Duration {
+		return 200 * time.Microsecond
+	})
+}
+
+func benchmarkDequeue(b *testing.B, latency func(map[string]any) time.Duration) {
+	log := &benchLog{done: make(chan struct{}), n: int64(b.N)}
+	base := Base{
+		client:           &benchStream{},
+		IProcessLog:      log,
+		subType:          btype.NormalSubscribe,
+		prefix:           "bench",
+		consumers:        10,
+		consumerPoolSize: 10,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	b.ResetTimer()
+	go func() {
+		defer close(stopped)
+		base.Dequeue(ctx, "channel", "topic", func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+			time.Sleep(latency(data))
+			return 0, nil
+		})
+	}()
+	<-log.done
+	b.StopTimer()
+
+	cancel()
+	<-stopped
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msg/s")
+}
+
+// BenchmarkBatch_MixedLatency the former fan-out, every batch waits for its slowest message
+func BenchmarkBatch_MixedLatency(b *testing.B) {
+	var seq int64
+	b.ResetTimer()
+	for handled := 0; handled < b.N; {
+		var wait sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			seq++
+			data := map[string]any{"seq": seq}
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				time.Sleep(latency(data))
+			}()
+		}
+		wait.Wait()
+		handled += 10
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msg/s")
+}
@@ -2,52 +2,61 @@ package bredis
 
 import (
 	"context"
+	"crypto/tls"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 )
 
-var (
-	rdb     redis.UniversalClient
-	rdbOnce sync.Once
-)
+// Options the connection settings besides the address and the pool
+type Options struct {
+	// Username the Redis 6 ACL user
+	Username string
+	// MasterName the sentinel master, the hosts are then the sentinels
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+	TLSConfig        *tls.Config
+}
 
+// NewRdb a new connection pool on each call, the caller owns it and closes it
 func NewRdb(host, port string, password string,
 	database, maxRetries int, dialTimeout,
-	readTimeout, writeTimeout, poolTimeout time.Duration, poolSize, minIdleConns int) redis.UniversalClient {
+	readTimeout, writeTimeout, poolTimeout time.Duration, poolSize, minIdleConns int, options Options) redis.UniversalClient {
 
-	rdbOnce.Do(func() {
-		ctx := context.Background()
-
-		hosts := strings.Split(host, ",")
-		for i, h := range hosts {
-			hs := strings.Split(h, ":")
-			if len(hs) == 1 {
-				hosts[i] = strings.Join([]string{h, port}, ":")
-			}
-		}
+	ctx := context.Background()
 
-		rdb = redis.NewUniversalClient(&redis.UniversalOptions{
-			Addrs:          hosts,
-			Password:       password,
-			DB:             database,
-			MaxRetries:     maxRetries,
-			DialTimeout:    dialTimeout,
-			ReadTimeout:    readTimeout,
-			WriteTimeout:   writeTimeout,
-			PoolSize:       poolSize,
-			MinIdleConns:   minIdleConns,
-			PoolTimeout:    poolTimeout,
-			RouteByLatency: true,
-		})
-
-		if err := rdb.Ping(ctx).Err(); err != nil {
-			logger.New().Fatal(err.Error())
+	hosts := strings.Split(host, ",")
+	for i, h := range hosts {
+		hs := strings.Split(h, ":")
+		if len(hs) == 1 {
+			hosts[i] = strings.Join([]string{h, port}, ":")
 		}
+	}
+
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            hosts,
+		Username:         options.Username,
+		Password:         password,
+		SentinelUsername: options.SentinelUsername,
+		SentinelPassword: options.SentinelPassword,
+		MasterName:       options.MasterName,
+		TLSConfig:        options.TLSConfig,
+		DB:               database,
+		MaxRetries:       maxRetries,
+		DialTimeout:      dialTimeout,
+		ReadTimeout:      readTimeout,
+		WriteTimeout:     writeTimeout,
+		PoolSize:         poolSize,
+		MinIdleConns:     minIdleConns,
+		PoolTimeout:      poolTimeout,
+		RouteByLatency:   true,
 	})
 
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		logger.New().Fatal(err.Error())
+	}
 	return rdb
 }
@@ -0,0 +1,112 @@
+package bredis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/cast"
+)
+
+// deadLetterConsumer the consumer the idle pending messages are claimed by before they are acked
+const deadLetterConsumer = "dead_letter"
+
+// xAutoClaim claim up to Count pending messages idle for MinIdle from Start, returns the cursor of the next call,
+// "0-0" once the whole pending list has been scanned.
+// The reply is parsed by hand because Redis 7 adds the deleted ids to it, which go-redis v8 can't read,
+// and the servers before 6.2 fall back to XPENDING and XCLAIM.
+func xAutoClaim(ctx context.Context, client redis.UniversalClient, args *redis.XAutoClaimArgs) (string, []redis.XMessage, error) {
+	reply, err := client.Do(ctx, "XAUTOCLAIM", args.Stream, args.Group, args.Consumer,
+		args.MinIdle.Milliseconds(), args.Start, "COUNT", args.Count).Slice()
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown command") {
+			return xClaimPending(ctx, client, args)
+		}
+		return "", nil, err
+	}
+	if len(reply) < 2 {
+		return "", nil, fmt.Errorf("xautoclaim: unexpected reply %v", reply)
+	}
+
+	entries, _ := reply[1].([]any)
+	messages := make([]redis.XMessage, 0, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.([]any)
+		if !ok || len(fields) < 1 {
+			continue
+		}
+		message := redis.XMessage{ID: cast.ToString(fields[0])}
+		if len(fields) > 1 {
+			if kvs, ok := fields[1].([]any); ok {
+				message.Values = make(map[string]any, len(kvs)/2)
+				for i := 0; i+1 < len(kvs); i += 2 {
+					message.Values[cast.ToString(kvs[i])] = kvs[i+1]
+				}
+			}
+		}
+		messages = append(messages, message)
+	}
+	// Redis 7 has already removed the deleted entries from the pending list
+	return cast.ToString(reply[0]), messages, nil
+}
+
+// xClaimPending the XAUTOCLAIM of the servers before 6.2
+func xClaimPending(ctx context.Context, client redis.UniversalClient, args *redis.XAutoClaimArgs) (string, []redis.XMessage, error) {
+	pendings, err := client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: args.Stream,
+		Group:  args.Group,
+		Start:  args.Start,
+		End:    "+",
+		Count:  args.Count,
+	}).Result()
+	if err != nil {
+		return "", nil, err
+	}
+
+	next := "0-0"
+	if int64(len(pendings)) >= args.Count && len(pendings) > 0 {
+		next = nextStreamID(pendings[len(pendings)-1].ID)
+	}
+
+	ids := make([]string, 0, len(pendings))
+	for _, pending := range pendings {
+		if pending.Idle >= args.MinIdle {
+			ids = append(ids, pending.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return next, nil, nil
+	}
+
+	messages, err := client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   args.Stream,
+		Group:    args.Group,
+		Consumer: args.Consumer,
+		MinIdle:  args.MinIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return "", nil, err
+	}
+	// the deleted entries are not returned but still pending, keep their ids so they get acked
+	claimed := make(map[string]struct{}, len(messages))
+	for _, message := range messages {
+		claimed[message.ID] = struct{}{}
+	}
+	for _, id := range ids {
+		if _, ok := claimed[id]; !ok {
+			messages = append(messages, redis.XMessage{ID: id})
+		}
+	}
+	return next, messages, nil
+}
+
+// nextStreamID the smallest id after `id`, XPENDING has no exclusive range before 6.2
+func nextStreamID(id string) string {
+	ms, seq, found := strings.Cut(id, "-")
+	if !found {
+		return id
+	}
+	return fmt.Sprintf("%s-%d", ms, cast.ToUint64(seq)+1)
+}
@@ -0,0 +1,138 @@
+package bredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+// pending add `published` messages which have never been received and `received` ones,
+// and leave all of them pending, read by consumers a and b in turns
+func (s *RedisSuite) pending(streamKey, group string, published, received int) []string {
+	s.Require().NoError(s.client.XGroupCreateMkStream(s.ctx, streamKey, group, "0").Err())
+
+	ids := make([]string, 0, published+received)
+	for i := 0; i < published+received; i++ {
+		status := bstatus.StatusPublished
+		if i >= published {
+			status = bstatus.StatusReceived
+		}
+		id, err := s.client.XAdd(s.ctx, &redis.XAddArgs{Stream: streamKey, Values: map[string]any{
+			"id": cast.ToString(i), "channel": group, "topic": "reclaim", "status": status,
+		}}).Result()
+		s.Require().NoError(err)
+		ids = append(ids, id)
+	}
+	for i := 0; i < len(ids); i++ {
+		consumer := "a"
+		if i%2 == 1 {
+			consumer = "b"
+		}
+		s.Require().NoError(s.client.XReadGroup(s.ctx, &redis.XReadGroupArgs{
+			Group: group, Consumer: consumer, Streams: []string{streamKey, ">"}, Count: 1,
+		}).Err())
+	}
+	return ids
+}
+
+// claimAll walk the pending list with claim `count` messages at a time, returns the claimed ids in order
+func (s *RedisSuite) claimAll(claim func(*redis.XAutoClaimArgs) (string, []redis.XMessage, error), streamKey, group string, count int64) []string {
+	var (
+		claimed []string
+		start   = "0-0"
+	)
+	for calls := 0; ; calls++ {
+		s.Require().Less(calls, 100, "the cursor must come back to 0-0")
+		next, messages, err := claim(&redis.XAutoClaimArgs{
+			Stream: streamKey, Group: group, Consumer: deadLetterConsumer, Start: start, Count: count,
+		})
+		s.Require().NoError(err)
+		s.LessOrEqual(int64(len(messages)), count)
+		for _, message := range messages {
+			claimed = append(claimed, message.ID)
+		}
+		if next == "0-0" {
+			return claimed
+		}
+		start = next
+	}
+}
+
+func (s *RedisSuite) TestXAutoClaim_batches() {
+	streamKey := tool.MakeStreamKey(btype.NormalSubscribe, s.prefix, "autoclaim", "reclaim")
+	ids := s.pending(streamKey, "autoclaim", 2, 5)
+
+	claimed := s.claimAll(func(args *redis.XAutoClaimArgs) (string, []redis.XMessage, error) {
+		return xAutoClaim(s.ctx, s.client, args)
+	}, streamKey, "autoclaim", 2)
+	s.Equal(ids, claimed, "every pending message is claimed once, in order")
+
+	consumers := s.client.XPendingExt(s.ctx, &redis.XPendingExtArgs{
+		Stream: streamKey, Group: "autoclaim", Start: "-", End: "+", Count: 100,
+	}).Val()
+	s.Len(consumers, len(ids))
+	for _, pending := range consumers {
+		s.Equal(deadLetterConsumer, pending.Consumer)
+	}
+}
+
+func (s *RedisSuite) TestXClaimPending_batches() {
+	streamKey := tool.MakeStreamKey(btype.NormalSubscribe, s.prefix, "claimpending", "reclaim")
+	ids := s.pending(streamKey, "claimpending", 3, 3)
+
+	claim := func(args *redis.XAutoClaimArgs) (string, []redis.XMessage, error) {
+		return xClaimPending(s.ctx, s.client, args)
+	}
+	// a count dividing the pending list ends with an empty batch, the others with a short one
+	s.Equal(ids, s.claimAll(claim, streamKey, "claimpending", 3))
+	s.Equal(ids, s.claimAll(claim, streamKey, "claimpending", 4))
+
+	// idle messages only
+	next, messages, err := xClaimPending(s.ctx, s.client, &redis.XAutoClaimArgs{
+		Stream: streamKey, Group: "claimpending", Consumer: deadLetterConsumer, MinIdle: time.Hour, Start: "0-0", Count: 10,
+	})
+	s.Require().NoError(err)
+	s.Equal("0-0", next)
+	s.Empty(messages)
+}
+
+func (s *RedisSuite) TestReclaim() {
+	base := &Base{client: s.client, prefix: s.prefix, subType: btype.NormalSubscribe, deadLetterIdle: time.Hour, deadLetterBatch: 2}
+	streamKey := tool.MakeStreamKey(btype.NormalSubscribe, s.prefix, "reclaim", "reclaim")
+	s.pending(streamKey, "reclaim", 2, 5)
+
+	reclaimed, err := base.reclaim(s.ctx, "reclaim", streamKey)
+	s.Require().NoError(err)
+	s.Zero(reclaimed, "no message has been idle long enough")
+
+	// four batches over the messages of both consumers
+	base.deadLetterIdle = 0
+	reclaimed, err = base.reclaim(s.ctx, "reclaim", streamKey)
+	s.Require().NoError(err)
+	s.Equal(7, reclaimed)
+
+	s.Zero(s.client.XPending(s.ctx, streamKey, "reclaim").Val().Count, "the pending list is drained")
+	requeued := s.client.XRange(s.ctx, streamKey, "-", "+").Val()
+	s.Len(requeued, 2, "the messages never received are queued again")
+	for _, message := range requeued {
+		s.Equal(string(bstatus.StatusPublished), message.Values["status"])
+	}
+	logs := s.client.XRange(s.ctx, tool.MakeLogicKey(s.prefix), "-", "+").Val()
+	s.Len(logs, 5, "the received messages are logged as dead letters")
+	for _, log := range logs {
+		s.Equal(string(bstatus.Dlq), log.Values["logType"])
+	}
+	s.Equal("7", s.client.HGet(s.ctx, tool.MakeDeadLetterReclaimedKey(s.prefix), "total").Val(), "the reclaimed messages are counted")
+}
+
+func TestNextStreamID(t *testing.T) {
+	assert.Equal(t, "1-1", nextStreamID("1-0"))
+	assert.Equal(t, "1700000000000-10", nextStreamID("1700000000000-9"))
+	assert.Equal(t, "0", nextStreamID("0"), "not a stream id")
+}
@@ -0,0 +1,198 @@
+package bredis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
+	"github.com/retail-ai-inc/beanq/v4/helper/json"
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+	"github.com/spf13/cast"
+)
+
+func (s *RedisSuite) TestNormal_dedup() {
+	normal := NewNormal(s.client, s.prefix, 100, 10, 10, time.Minute, nil)
+	message := func(id, dedupKey string) map[string]any {
+		return map[string]any{"id": id, "channel": "dedup", "topic": "normal", "payload": id,
+			"dedupKey": dedupKey, "dedupWindow": "10s"}
+	}
+
+	s.Require().NoError(normal.Enqueue(s.ctx, message("1", "order-1")))
+	err := normal.Enqueue(s.ctx, message("2", "order-1"))
+	s.True(errors.Is(err, bstatus.ErrIdempotent), "a second publish in the window is a duplicate, got: %v", err)
+	s.Require().NoError(normal.Enqueue(s.ctx, message("3", "order-2")), "another key is published")
+
+	stream := tool.MakeStreamKey(btype.NormalSubscribe, s.prefix, "dedup", "normal")
+	s.Equal(int64(2), s.client.XLen(s.ctx, stream).Val())
+
+	ttl := s.client.PTTL(s.ctx, tool.MakeDedupKey(s.prefix, "dedup", "normal", "order-1")).Val()
+	s.True(ttl > 0 && ttl <= 10*time.Second, "the dedup key expires with the window, got: %v", ttl)
+}
+
+func (s *RedisSuite) TestSchedule_dedup() {
+	schedule := NewSchedule(s.client, s.prefix, 10, 10, time.Minute, nil)
+	message := func(id string) map[string]any {
+		return map[string]any{"id": id, "channel": "dedup", "topic": "delay", "payload": id,
+			"executeTime": time.Now().Add(time.Hour), "dedupKey": "order-1", "dedupWindow": "10s"}
+	}
+
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("1")))
+	err := schedule.Enqueue(s.ctx, message("2"))
+	s.True(errors.Is(err, bstatus.ErrIdempotent), "a second publish in the window is a duplicate, got: %v", err)
+
+	s.Equal(int64(1), s.client.ZCard(s.ctx, tool.MakeZSetKey(s.prefix, "dedup", "delay")).Val())
+}
+
+// collapsed returns the payloads and the scores of the delay queue, earliest first
+func (s *RedisSuite) collapsed(channel, topic string) ([]string, []float64) {
+	zs := s.client.ZRangeWithScores(s.ctx, tool.MakeZSetKey(s.prefix, channel, topic), 0, -1).Val()
+	payloads := make([]string, 0, len(zs))
+	scores := make([]float64, 0, len(zs))
+	for _, z := range zs {
+		var data map[string]any
+		s.Require().NoError(json.Unmarshal([]byte(z.Member.(string)), &data))
+		payloads = append(payloads, data["payload"].(string))
+		scores = append(scores, z.Score)
+	}
+	return payloads, scores
+}
+
+func (s *RedisSuite) TestSchedule_debounce() {
+	schedule := NewSchedule(s.client, s.prefix, 10, 10, time.Minute, nil)
+	first := time.Now().Add(10 * time.Second)
+	message := func(id string, executeTime time.Time) map[string]any {
+		return map[string]any{"id": id, "channel": "collapse", "topic": "debounce", "payload": id,
+			"executeTime": executeTime, "collapseKey": "user-1", "collapseMode": "debounce", "collapseWindow": "10s"}
+	}
+
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("1", first)))
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("2", first.Add(time.Second))))
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("3", first.Add(2*time.Second))))
+
+	payloads, scores := s.collapsed("collapse", "debounce")
+	s.Equal([]string{"3"}, payloads, "the last payload wins")
+	s.Equal(float64(first.UnixMilli()), scores[0], "the delivery stays at the first publish of the window")
+}
+
+func (s *RedisSuite) TestSchedule_throttle() {
+	schedule := NewSchedule(s.client, s.prefix, 10, 10, time.Minute, nil)
+	now := time.Now()
+	message := func(id string) map[string]any {
+		return map[string]any{"id": id, "channel": "collapse", "topic": "throttle", "payload": id,
+			"executeTime": now, "collapseKey": "user-1", "collapseMode": "throttle", "collapseWindow": "10s"}
+	}
+
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("1")))
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("2")))
+	payloads, scores := s.collapsed("collapse", "throttle")
+	s.Equal([]string{"2"}, payloads, "a publish before the delivery replaces the pending one")
+	s.Equal(float64(now.UnixMilli()), scores[0])
+
+	// the pending one is delivered, the next publish waits for the next slot
+	s.Require().NoError(s.client.Del(s.ctx, tool.MakeZSetKey(s.prefix, "collapse", "throttle")).Err())
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("3")))
+	payloads, scores = s.collapsed("collapse", "throttle")
+	s.Equal([]string{"3"}, payloads)
+	s.Equal(float64(now.Add(10*time.Second).UnixMilli()), scores[0])
+}
+
+func (s *RedisSuite) TestSchedule_dedupAndCollapse() {
+	schedule := NewSchedule(s.client, s.prefix, 10, 10, time.Minute, nil)
+	err := schedule.Enqueue(s.ctx, map[string]any{"id": "1", "channel": "collapse", "topic": "both", "payload": "1",
+		"executeTime": time.Now(), "dedupKey": "order-1", "dedupWindow": "10s",
+		"collapseKey": "user-1", "collapseMode": "debounce", "collapseWindow": "10s"})
+	s.Error(err, "dedup and collapse are exclusive")
+	s.Equal(int64(0), s.client.ZCard(s.ctx, tool.MakeZSetKey(s.prefix, "collapse", "both")).Val())
+}
+
+// publishedLogs returns the ids of the published logs in the logic log, oldest first
+func (s *RedisSuite) publishedLogs() []string {
+	logs := s.client.XRange(s.ctx, tool.MakeLogicKey(s.prefix), "-", "+").Val()
+	ids := make([]string, 0, len(logs))
+	for _, log := range logs {
+		s.Equal(string(bstatus.StatusPublished), log.Values["status"])
+		s.Equal(string(bstatus.Logic), log.Values["logType"])
+		ids = append(ids, log.Values["id"].(string))
+	}
+	return ids
+}
+
+func (s *RedisSuite) TestEnqueueNormal_log() {
+	normal := NewNormal(s.client, s.prefix, 100, 10, 10, time.Minute, nil)
+	message := func(id string) map[string]any {
+		return map[string]any{"id": id, "channel": "enqueue", "topic": "normal", "payload": id,
+			"dedupKey": "order-1", "dedupWindow": "10s"}
+	}
+
+	s.Require().NoError(normal.Enqueue(s.ctx, message("1")))
+	s.Require().ErrorIs(normal.Enqueue(s.ctx, message("2")), bstatus.ErrIdempotent)
+
+	s.Equal(int64(1), s.client.XLen(s.ctx, tool.MakeStreamKey(btype.NormalSubscribe, s.prefix, "enqueue", "normal")).Val())
+	s.Equal([]string{"1"}, s.publishedLogs(), "a duplicate writes no log")
+}
+
+func (s *RedisSuite) TestEnqueueNormal_logTrimmed() {
+	normal := NewNormal(s.client, s.prefix, 100, 10, 10, time.Minute, nil)
+	normal.base.setLogicLog(2, true)
+	for i := 0; i < 5; i++ {
+		s.Require().NoError(normal.Enqueue(s.ctx, map[string]any{"id": cast.ToString(i), "channel": "enqueue", "topic": "trim"}))
+	}
+
+	// MAXLEN ~ trims whole nodes, how many entries go depends on the server, none of them uncounted
+	kept := s.client.XLen(s.ctx, tool.MakeLogicKey(s.prefix)).Val()
+	trimmed := cast.ToInt64(s.client.HGet(s.ctx, tool.MakeLogicTrimmedKey(s.prefix), "total").Val())
+	s.Equal(int64(5), kept+trimmed)
+}
+
+func (s *RedisSuite) TestEnqueueNormal_logNotMigrated() {
+	normal := NewNormal(s.client, s.prefix, 100, 10, 10, time.Minute, nil)
+	normal.base.setLogicLog(2, false)
+	for i := 0; i < 5; i++ {
+		s.Require().NoError(normal.Enqueue(s.ctx, map[string]any{"id": cast.ToString(i), "channel": "enqueue", "topic": "trim"}))
+	}
+	s.Require().NoError(normal.base.AddLog(s.ctx, map[string]any{"id": "5", "channel": "enqueue", "topic": "trim"}))
+
+	s.NotZero(s.client.XLen(s.ctx, tool.MakeLogicKey(s.prefix)).Val())
+	s.Zero(s.client.Exists(s.ctx, tool.MakeLogicTrimmedKey(s.prefix)).Val(), "nothing is counted without a history")
+}
+
+func (s *RedisSuite) TestEnqueueSequence_log() {
+	sequence := NewSequence(s.client, s.prefix, 10, 10, time.Minute, nil)
+	message := map[string]any{"id": "1", "channel": "enqueue", "topic": "sequence", "payload": "1"}
+
+	s.Require().NoError(sequence.Enqueue(s.ctx, message))
+	s.Require().ErrorIs(sequence.Enqueue(s.ctx, message), bstatus.ErrIdempotent)
+
+	s.Equal(int64(1), s.client.XLen(s.ctx, tool.MakeStreamKey(btype.SequentialSubscribe, s.prefix, "enqueue", "sequence")).Val())
+	s.Equal(string(bstatus.StatusPublished), s.client.HGet(s.ctx, tool.MakeStatusKey(s.prefix, "enqueue", "sequence", "1"), "status").Val())
+	s.Equal([]string{"1"}, s.publishedLogs(), "a duplicate writes no log")
+}
+
+func (s *RedisSuite) TestEnqueueSequenceByLock_log() {
+	sequenceByLock := NewSequenceByLock(s.client, s.prefix, 10, 10, time.Minute, nil)
+	message := func(id string) map[string]any {
+		return map[string]any{"id": id, "channel": "enqueue", "topic": "lock", "payload": id,
+			"orderKey": "order-1", "lockOrderKeyTTL": "10s"}
+	}
+
+	s.Require().NoError(sequenceByLock.Enqueue(s.ctx, message("1")))
+	s.Require().ErrorIs(sequenceByLock.Enqueue(s.ctx, message("2")), bstatus.SequentialLockError, "the order key is locked")
+
+	s.Equal(int64(1), s.client.XLen(s.ctx, tool.MakeStreamKey(btype.SequentialByLockSubscribe, s.prefix, "enqueue", "lock")).Val())
+	s.Equal([]string{"1"}, s.publishedLogs(), "a locked publish writes no log")
+}
+
+func (s *RedisSuite) TestEnqueueDelay_log() {
+	schedule := NewSchedule(s.client, s.prefix, 10, 10, time.Minute, nil)
+	message := func(id string) map[string]any {
+		return map[string]any{"id": id, "channel": "enqueue", "topic": "delay", "payload": id,
+			"executeTime": time.Now().Add(time.Hour), "dedupKey": "order-1", "dedupWindow": "10s"}
+	}
+
+	s.Require().NoError(schedule.Enqueue(s.ctx, message("1")))
+	s.Require().ErrorIs(schedule.Enqueue(s.ctx, message("2")), bstatus.ErrIdempotent)
+
+	s.Equal(int64(1), s.client.ZCard(s.ctx, tool.MakeZSetKey(s.prefix, "enqueue", "delay")).Val())
+	s.Equal([]string{"1"}, s.publishedLogs(), "a duplicate writes no log")
+}
@@ -0,0 +1,44 @@
+package bredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+)
+
+// processedValue the value of the key of a message once its handler has succeeded
+const processedValue = "done"
+
+// Idempotent claim a message before it is handled and remember it once it has been handled successfully,
+// so a redelivered message is skipped by the consumer even while the first delivery is still running
+type Idempotent struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewIdempotent(client redis.UniversalClient, prefix string) *Idempotent {
+	return &Idempotent{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Claim take the message for `token` until `ttl`, it fails when the message is being handled or has been handled
+func (t *Idempotent) Claim(ctx context.Context, channel, topic, id, token string, ttl time.Duration) (bool, error) {
+	key := tool.MakeProcessedKey(t.prefix, channel, topic, id)
+	return t.client.SetNX(ctx, key, token, ttl).Result()
+}
+
+// Done keep the message as handled for `ttl`, as long as `token` still holds the claim
+func (t *Idempotent) Done(ctx context.Context, channel, topic, id, token string, ttl time.Duration) error {
+	key := tool.MakeProcessedKey(t.prefix, channel, topic, id)
+	return IdempotentFinishScript.Run(ctx, t.client, []string{key}, token, processedValue, ttl.Milliseconds()).Err()
+}
+
+// Release give up the claim of `token`, the message can be handled again
+func (t *Idempotent) Release(ctx context.Context, channel, topic, id, token string) error {
+	key := tool.MakeProcessedKey(t.prefix, channel, topic, id)
+	return IdempotentFinishScript.Run(ctx, t.client, []string{key}, token, "", 0).Err()
+}
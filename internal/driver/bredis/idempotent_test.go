@@ -0,0 +1,38 @@
+package bredis
+
+import (
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+)
+
+func (s *RedisSuite) TestIdempotent() {
+	idempotent := NewIdempotent(s.client, s.prefix)
+	key := tool.MakeProcessedKey(s.prefix, "idempotent", "topic", "1")
+
+	claimed, err := idempotent.Claim(s.ctx, "idempotent", "topic", "1", "a", time.Minute)
+	s.Require().NoError(err)
+	s.True(claimed)
+	claimed, err = idempotent.Claim(s.ctx, "idempotent", "topic", "1", "b", time.Minute)
+	s.Require().NoError(err)
+	s.False(claimed, "a message being handled can't be claimed")
+
+	s.Require().NoError(idempotent.Release(s.ctx, "idempotent", "topic", "1", "b"))
+	s.Equal("a", s.client.Get(s.ctx, key).Val(), "only the holder releases the claim")
+	s.Require().NoError(idempotent.Release(s.ctx, "idempotent", "topic", "1", "a"))
+
+	claimed, err = idempotent.Claim(s.ctx, "idempotent", "topic", "1", "c", time.Minute)
+	s.Require().NoError(err)
+	s.True(claimed, "a released message is claimed again")
+
+	s.Require().NoError(idempotent.Done(s.ctx, "idempotent", "topic", "1", "c", time.Hour))
+	s.Equal(processedValue, s.client.Get(s.ctx, key).Val())
+	ttl := s.client.PTTL(s.ctx, key).Val()
+	s.True(ttl > time.Minute && ttl <= time.Hour, "done is kept for the idempotency ttl, got: %v", ttl)
+
+	claimed, err = idempotent.Claim(s.ctx, "idempotent", "topic", "1", "d", time.Minute)
+	s.Require().NoError(err)
+	s.False(claimed, "a handled message can't be claimed")
+	s.Require().NoError(idempotent.Release(s.ctx, "idempotent", "topic", "1", "d"))
+	s.Equal(processedValue, s.client.Get(s.ctx, key).Val(), "a handled message is never released")
+}
@@ -3,6 +3,7 @@ package bredis
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -11,12 +12,15 @@ import (
 	"github.com/retail-ai-inc/beanq/v4/helper/timex"
 	"github.com/retail-ai-inc/beanq/v4/helper/tool"
 	public "github.com/retail-ai-inc/beanq/v4/internal"
+	"github.com/retail-ai-inc/beanq/v4/internal/capture"
 )
 
 type Log struct {
-	client redis.UniversalClient
-	log    public.IMigrateLog
-	prefix string
+	client        redis.UniversalClient
+	log           public.IMigrateLog
+	prefix        string
+	captureConfig *capture.Config
+	spill         *logSpill
 }
 
 func NewLog(client redis.UniversalClient, prefix string, log public.IMigrateLog) *Log {
@@ -27,23 +31,53 @@ func NewLog(client redis.UniversalClient, prefix string, log public.IMigrateLog)
 	}
 }
 
+// SetCaptureConfig alert the logic log entries trimmed before they are migrated
+func (t *Log) SetCaptureConfig(config *capture.Config) *Log {
+	t.captureConfig = config
+	return t
+}
+
+// SetSpillDir write the batches the history refuses to `dir` and migrate them once it is back,
+// instead of leaving them in the logic log where the trimming drops them.
+// RecoverSpill has to be called on `dir` before the first Migrate.
+func (t *Log) SetSpillDir(dir string) *Log {
+	t.spill = &logSpill{dir: dir}
+	return t
+}
+
 func (t *Log) Migrate(ctx context.Context, data []map[string]any) error {
 
 	timer := timex.TimerPool.Get(5 * time.Second)
 	defer timex.TimerPool.Put(timer)
 
 	key := tool.MakeLogicKey(t.prefix)
+	// the batch the history has refused, it is migrated again before reading further
+	var refused []redis.XMessage
 
 	for {
 		// check state
 		select {
 		case <-ctx.Done():
-			_ = t.client.Close()
 			return nil
 		case <-timer.C:
 		}
 		timer.Reset(5 * time.Second)
 
+		if t.log != nil {
+			t.reportTrimmed(ctx)
+			if refused != nil {
+				if !t.migrate(ctx, key, refused) {
+					continue
+				}
+				refused = nil
+			}
+			if t.spill != nil {
+				if err := t.spill.replay(ctx, t.log); err != nil {
+					logger.New().Error(err)
+				}
+			}
+		}
+
 		result, err := t.client.XReadGroup(ctx, NewReadGroupArgs(tool.BeanqLogGroup, key, []string{key, ">"}, 200, 20*time.Second)).Result()
 		if err != nil {
 			if strings.Contains(err.Error(), "NOGROUP No such") {
@@ -67,29 +101,59 @@ func (t *Log) Migrate(ctx context.Context, data []map[string]any) error {
 			continue
 		}
 
-		messages := result[0].Messages
-		datas := make([]map[string]any, 0, len(messages))
-		ids := make([]string, 0, len(messages))
+		if t.log != nil && !t.migrate(ctx, key, result[0].Messages) {
+			refused = result[0].Messages
+		}
+	}
+}
+
+// migrate move the messages to the history, or to the spill directory when the history refuses them,
+// and remove them from the logic log. It returns false when they are still waiting in the log.
+func (t *Log) migrate(ctx context.Context, key string, messages []redis.XMessage) bool {
+	datas := make([]map[string]any, 0, len(messages))
+	ids := make([]string, 0, len(messages))
 
-		for _, v := range messages {
-			if v.ID != "" {
-				ids = append(ids, v.ID)
-				datas = append(datas, v.Values)
-			}
+	for _, v := range messages {
+		if v.ID != "" {
+			ids = append(ids, v.ID)
+			datas = append(datas, v.Values)
 		}
+	}
 
-		if t.log != nil {
-			if err := t.log.Migrate(ctx, datas); err != nil {
-				logger.New().Error(err)
-				continue
-			}
-			if _, err := t.client.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
-				pipeliner.XAck(ctx, key, tool.BeanqLogGroup, ids...)
-				pipeliner.XDel(ctx, key, ids...)
-				return nil
-			}); err != nil {
-				logger.New().Error(err)
-			}
+	if err := t.log.Migrate(ctx, datas); err != nil {
+		logger.New().Error(err)
+		if t.spill == nil {
+			return false
 		}
+		if err := t.spill.write(datas); err != nil {
+			logger.New().Error(err)
+			return false
+		}
+	}
+	if _, err := t.client.TxPipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.XAck(ctx, key, tool.BeanqLogGroup, ids...)
+		pipeliner.XDel(ctx, key, ids...)
+		return nil
+	}); err != nil {
+		logger.New().Error(err)
+	}
+	return true
+}
+
+// reportTrimmed alert the logic log entries trimmed before they were migrated, each of them once
+// whichever migrator takes the count
+func (t *Log) reportTrimmed(ctx context.Context) {
+	trimmed, err := TakeLogTrimmedScript.Run(ctx, t.client, []string{tool.MakeLogicTrimmedKey(t.prefix)}).Int64()
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logger.New().Error(err)
+		}
+		return
+	}
+	if trimmed <= 0 {
+		return
 	}
+	err = fmt.Errorf("%d logic log entries were trimmed before they were migrated to the history", trimmed)
+	logger.New().Error(err)
+	capture.System.When(t.captureConfig).If(nil).Then(err)
 }
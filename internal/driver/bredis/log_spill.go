@@ -0,0 +1,146 @@
+package bredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/json"
+	public "github.com/retail-ai-inc/beanq/v4/internal"
+)
+
+const (
+	spillExt    = ".jsonl"
+	replayExt   = ".replay"
+	spillTmpExt = ".tmp"
+)
+
+// logSpill keeps the logic logs the history refuses on disk, one json lines file per batch.
+// The files are named by the time they are written so they are replayed in order.
+type logSpill struct {
+	dir string
+}
+
+// write the batch to a temporary file first, a file only gets its final name once it is complete
+func (s *logSpill) write(datas []map[string]any) error {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(s.dir, fmt.Sprintf("beanq-logic-log-%d-*%s", time.Now().UnixNano(), spillTmpExt))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	encoder := json.Json.NewEncoder(w)
+	for _, data := range datas {
+		if err = encoder.Encode(data); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), strings.TrimSuffix(file.Name(), spillTmpExt)+spillExt)
+}
+
+// replay migrate the spilled files oldest first and stop at the first one the history refuses.
+// A file is claimed by renaming it, so the migrators sharing the directory never replay it twice.
+func (s *logSpill) replay(ctx context.Context, log public.IMigrateLog) error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spillExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		claimed := name + replayExt
+		if err := os.Rename(name, claimed); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// another migrator has claimed it
+				continue
+			}
+			return err
+		}
+
+		datas, err := readSpill(claimed)
+		if err == nil {
+			err = log.Migrate(ctx, datas)
+		}
+		if err != nil {
+			// hand it back for the next replay
+			if rerr := os.Rename(claimed, name); rerr != nil {
+				return errors.Join(err, rerr)
+			}
+			return err
+		}
+		if err := os.Remove(claimed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoveredSpills the spill directories RecoverSpill has handled in this process
+var recoveredSpills sync.Map
+
+// RecoverSpill hand back the files of `dir` whose replay has been interrupted by a stop, once per directory.
+// It has to run before the migrators sharing `dir` start: the file a running migrator has claimed
+// would be handed back and replayed twice.
+func RecoverSpill(dir string) error {
+	if _, done := recoveredSpills.LoadOrStore(filepath.Clean(dir), struct{}{}); done {
+		return nil
+	}
+	return (&logSpill{dir: dir}).recover()
+}
+
+// recover hand back the files whose replay has been interrupted by a stop
+func (s *logSpill) recover() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spillExt+replayExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Rename(name, strings.TrimSuffix(name, replayExt)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSpill(name string) ([]map[string]any, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var datas []map[string]any
+	decoder := json.Json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		var data map[string]any
+		if err := decoder.Decode(&data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		datas = append(datas, data)
+	}
+	return datas, nil
+}
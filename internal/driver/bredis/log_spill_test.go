@@ -0,0 +1,105 @@
+package bredis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// spillSink records the migrated logs, it refuses them while down
+type spillSink struct {
+	down     bool
+	migrated []map[string]any
+}
+
+func (s *spillSink) Migrate(ctx context.Context, data []map[string]any) error {
+	if s.down {
+		return errors.New("history is down")
+	}
+	s.migrated = append(s.migrated, data...)
+	return nil
+}
+
+func TestLogSpill_replay(t *testing.T) {
+	spill := &logSpill{dir: filepath.Join(t.TempDir(), "spill")}
+
+	for _, batch := range [][]map[string]any{
+		{{"id": "1", "status": "success"}, {"id": "2", "status": "failed"}},
+		{{"id": "3", "status": "published"}},
+	} {
+		if err := spill.write(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sink := &spillSink{down: true}
+	if err := spill.replay(context.Background(), sink); err == nil {
+		t.Fatal("Expected the refusal of the history")
+	}
+	if names, _ := filepath.Glob(filepath.Join(spill.dir, "*"+spillExt)); len(names) != 2 {
+		t.Fatalf("Expected the 2 files to be kept, got: %v", names)
+	}
+
+	sink.down = false
+	if err := spill.replay(context.Background(), sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.migrated) != 3 {
+		t.Fatalf("Expected 3 logs, got: %v", sink.migrated)
+	}
+	for i, data := range sink.migrated {
+		if id := data["id"]; id != string(rune('1'+i)) {
+			t.Errorf("Expected the logs in order, got id %v at %d", id, i)
+		}
+	}
+	if entries, _ := os.ReadDir(spill.dir); len(entries) != 0 {
+		t.Errorf("Expected the replayed files to be removed, got: %v", entries)
+	}
+}
+
+func TestLogSpill_recover(t *testing.T) {
+	spill := &logSpill{dir: t.TempDir()}
+	if err := spill.write([]map[string]any{{"id": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := filepath.Glob(filepath.Join(spill.dir, "*"+spillExt))
+	// a stop in the middle of the replay
+	if err := os.Rename(names[0], names[0]+replayExt); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spill.recover(); err != nil {
+		t.Fatal(err)
+	}
+	sink := &spillSink{}
+	if err := spill.replay(context.Background(), sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.migrated) != 1 {
+		t.Errorf("Expected the interrupted file to be replayed, got: %v", sink.migrated)
+	}
+}
+
+func TestRecoverSpill_once(t *testing.T) {
+	spill := &logSpill{dir: t.TempDir()}
+	if err := spill.write([]map[string]any{{"id": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverSpill(spill.dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// a migrator sharing the directory claims the file
+	names, _ := filepath.Glob(filepath.Join(spill.dir, "*"+spillExt))
+	if err := os.Rename(names[0], names[0]+replayExt); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverSpill(spill.dir + string(filepath.Separator)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(names[0] + replayExt); err != nil {
+		t.Errorf("Expected the claimed file to be left to its migrator, got: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
 	"github.com/retail-ai-inc/beanq/v4/helper/tool"
 	"github.com/retail-ai-inc/beanq/v4/internal"
 	"github.com/retail-ai-inc/beanq/v4/internal/btype"
@@ -36,6 +37,13 @@ func NewNormal(client redis.UniversalClient, prefix string, maxLen int64, consum
 	}
 }
 
+// SetPriorityLanes split the topic into `lanes` streams by message priority
+func (t *Normal) SetPriorityLanes(lanes, starvation int) *Normal {
+	t.base.lanes = lanes
+	t.base.starvation = starvation
+	return t
+}
+
 func (t *Normal) ForceUnlock(_ context.Context, channel, topic, orderKey string) error {
 
 	return nil
@@ -44,6 +52,7 @@ func (t *Normal) ForceUnlock(_ context.Context, channel, topic, orderKey string)
 func (t *Normal) Enqueue(ctx context.Context, data map[string]any) error {
 	channel := ""
 	topic := ""
+	var priority float64
 
 	if v, ok := data["channel"]; ok {
 		channel = cast.ToString(v)
@@ -51,15 +60,30 @@ func (t *Normal) Enqueue(ctx context.Context, data map[string]any) error {
 	if v, ok := data["topic"]; ok {
 		topic = cast.ToString(v)
 	}
+	if v, ok := data["priority"]; ok {
+		priority = cast.ToFloat64(v)
+	}
 
-	stream := tool.MakeStreamKey(t.base.subType, t.base.prefix, channel, topic)
-	args := NewZAddArgs(stream, "", "*", t.maxLen, 0, data)
+	lane := tool.PriorityLane(priority, t.base.lanes)
+	stream := tool.MakePriorityStreamKey(t.base.subType, t.base.prefix, channel, topic, lane)
 
-	err := t.base.client.XAdd(ctx, args).Err()
+	keys := []string{stream}
+	var window time.Duration
+	if key := cast.ToString(data["dedupKey"]); key != "" {
+		keys = append(keys, tool.MakeDedupKey(t.base.prefix, channel, topic, key))
+		window = cast.ToDuration(data["dedupWindow"])
+	}
+	keys, logMaxLen := t.base.publishKeys(keys...)
+
+	duplicate, err := EnqueueNormalScript.Run(ctx, t.base.client, keys, scriptArgs(data, logMaxLen, t.base.logMigrated, window.Milliseconds(), t.maxLen)...).Bool()
 	if err != nil {
 		return fmt.Errorf("[RedisBroker.enqueue] normal xadd error:%w", err)
 	}
+	if duplicate {
+		return fmt.Errorf("dedup check: %w", bstatus.ErrIdempotent)
+	}
 
+	t.base.publishedLog(ctx, logMaxLen, data)
 	return nil
 }
 
@@ -67,5 +91,10 @@ func (t *Normal) Dequeue(ctx context.Context, channel, topic string, do public.C
 	go func() {
 		t.base.DeadLetter(ctx, channel, topic)
 	}()
+	for lane := 1; lane < t.base.lanes; lane++ {
+		go func(streamKey string) {
+			t.base.deadLetter(ctx, channel, topic, streamKey)
+		}(tool.MakePriorityStreamKey(t.base.subType, t.base.prefix, channel, topic, lane))
+	}
 	t.base.Dequeue(ctx, channel, topic, do)
 }
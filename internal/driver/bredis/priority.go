@@ -0,0 +1,127 @@
+package bredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+)
+
+// priorityLanes reads a topic which is split into several streams by priority.
+// The highest lane is always read first, a lower lane which has been passed over
+// `starvation` times in a row is read before the others once.
+type priorityLanes struct {
+	// keys lane 0 (lowest priority) first
+	keys       []string
+	waits      []int
+	starvation int
+	// rest the messages a read on every lane has returned beyond its count,
+	// they are pending for the consumer already and served before the lanes are read again
+	rest []redis.XStream
+}
+
+func newPriorityLanes(subType btype.SubscribeType, prefix, channel, topic string, lanes, starvation int) *priorityLanes {
+	if lanes <= 1 {
+		return nil
+	}
+	keys := make([]string, lanes)
+	for i := range keys {
+		keys[i] = tool.MakePriorityStreamKey(subType, prefix, channel, topic, i)
+	}
+	return &priorityLanes{
+		keys:       keys,
+		waits:      make([]int, lanes),
+		starvation: starvation,
+	}
+}
+
+// order returns the lanes to try for the next batch
+func (p *priorityLanes) order() []int {
+	starved := -1
+	if p.starvation > 0 {
+		for i := range p.keys {
+			if p.waits[i] >= p.starvation && (starved < 0 || p.waits[i] > p.waits[starved]) {
+				starved = i
+			}
+		}
+	}
+
+	order := make([]int, 0, len(p.keys))
+	if starved >= 0 {
+		order = append(order, starved)
+	}
+	for i := len(p.keys) - 1; i >= 0; i-- {
+		if i != starved {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// passOver counts one more skipped batch for every lane below the served one
+func (p *priorityLanes) passOver(served int) {
+	for i := 0; i < served; i++ {
+		p.waits[i]++
+	}
+}
+
+// read returns `count` messages at most, the highest lane with messages first
+func (p *priorityLanes) read(ctx context.Context, client redis.UniversalClient, group, consumer string, count int64, block time.Duration) ([]redis.XStream, error) {
+	if len(p.rest) > 0 {
+		return p.take(count), nil
+	}
+	for _, lane := range p.order() {
+		streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{p.keys[lane], ">"},
+			Count:    count,
+			Block:    -1,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		p.waits[lane] = 0
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			p.passOver(lane)
+			return streams, nil
+		}
+	}
+
+	// every lane is empty, wait on all of them at once.
+	// COUNT applies to every stream, the messages beyond `count` are kept for the next reads
+	streams := make([]string, 0, 2*len(p.keys))
+	for i := len(p.keys) - 1; i >= 0; i-- {
+		streams = append(streams, p.keys[i])
+	}
+	for range p.keys {
+		streams = append(streams, ">")
+	}
+	rest, err := client.XReadGroup(ctx, NewReadGroupArgs(group, consumer, streams, count, block)).Result()
+	if err != nil {
+		return nil, err
+	}
+	p.rest = rest
+	return p.take(count), nil
+}
+
+// take remove up to `count` messages from the rest, in the order they have been read
+func (p *priorityLanes) take(count int64) []redis.XStream {
+	var taken []redis.XStream
+	for count > 0 && len(p.rest) > 0 {
+		stream := &p.rest[0]
+		n := min(count, int64(len(stream.Messages)))
+		if n > 0 {
+			taken = append(taken, redis.XStream{Stream: stream.Stream, Messages: stream.Messages[:n]})
+			stream.Messages = stream.Messages[n:]
+			count -= n
+		}
+		if len(stream.Messages) == 0 {
+			p.rest = p.rest[1:]
+		}
+	}
+	return taken
+}
@@ -0,0 +1,131 @@
+package bredis
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+)
+
+// fillLanes add `n` messages to each of `lanes` and create the group on every lane
+func (s *RedisSuite) fillLanes(p *priorityLanes, n int, lanes ...int) {
+	for _, key := range p.keys {
+		s.Require().NoError(s.client.XGroupCreateMkStream(s.ctx, key, "group", "0").Err())
+	}
+	for _, lane := range lanes {
+		for i := 0; i < n; i++ {
+			s.Require().NoError(s.client.XAdd(s.ctx, &redis.XAddArgs{Stream: p.keys[lane], Values: map[string]any{"lane": lane}}).Err())
+		}
+	}
+}
+
+// readLanes read one message at a time and return the lane each came from
+func (s *RedisSuite) readLanes(p *priorityLanes, reads int) []int {
+	served := make([]int, 0, reads)
+	for i := 0; i < reads; i++ {
+		streams, err := p.read(s.ctx, s.client, "group", "consumer", 1, 0)
+		s.Require().NoError(err)
+		s.Require().NotEmpty(streams)
+		for lane, key := range p.keys {
+			if streams[0].Stream == key {
+				served = append(served, lane)
+			}
+		}
+	}
+	return served
+}
+
+func (s *RedisSuite) TestPriorityLanes_order() {
+	p := newPriorityLanes(btype.NormalSubscribe, s.prefix, "priority", "order", 3, -1)
+	s.fillLanes(p, 2, 0, 1, 2)
+
+	s.Equal([]int{2, 2, 1, 1, 0, 0}, s.readLanes(p, 6), "the highest lane is drained first")
+}
+
+func (s *RedisSuite) TestPriorityLanes_starvation() {
+	p := newPriorityLanes(btype.NormalSubscribe, s.prefix, "priority", "starvation", 3, 2)
+	s.fillLanes(p, 10, 0, 2)
+
+	// lane 0 is read once after being passed over twice, the empty lane 1 doesn't hold lane 2 back
+	s.Equal([]int{2, 2, 0, 2, 2, 0, 2, 2, 0}, s.readLanes(p, 9))
+}
+
+func (s *RedisSuite) TestPriorityLanes_single() {
+	s.Nil(newPriorityLanes(btype.NormalSubscribe, s.prefix, "priority", "single", 1, 2), "a single lane reads the plain stream")
+}
+
+func (s *RedisSuite) TestPriorityLanes_blockingRead() {
+	p := newPriorityLanes(btype.NormalSubscribe, s.prefix, "priority", "blocking", 2, 0)
+	s.fillLanes(p, 0)
+
+	read := make(chan []redis.XStream)
+	go func() {
+		streams, _ := p.read(s.ctx, s.client, "group", "consumer", 1, 2*time.Second)
+		read <- streams
+	}()
+	// both lanes are filled while the read waits on all of them
+	time.Sleep(100 * time.Millisecond)
+	_, err := s.client.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range p.keys {
+			pipe.XAdd(s.ctx, &redis.XAddArgs{Stream: key, Values: map[string]any{"lane": key}})
+		}
+		return nil
+	})
+	s.Require().NoError(err)
+
+	streams := <-read
+	s.Require().Len(streams, 1)
+	s.Len(streams[0].Messages, 1, "no more than count messages are returned")
+	s.Equal(p.keys[1], streams[0].Stream, "the highest lane first")
+
+	// the other one has been read already, it is served without waiting
+	streams, err = p.read(s.ctx, s.client, "group", "consumer", 1, 0)
+	s.Require().NoError(err)
+	s.Require().Len(streams, 1)
+	s.Equal(p.keys[0], streams[0].Stream)
+	s.Len(streams[0].Messages, 1)
+}
+
+func (s *RedisSuite) TestDequeue_lanesSingleWorker() {
+	normal := NewNormal(s.client, s.prefix, 100, 10, 1, time.Minute, nil).SetPriorityLanes(2, 0)
+	p := newPriorityLanes(btype.NormalSubscribe, s.prefix, "priority", "worker", 2, 0)
+
+	var handled atomic.Int64
+	ctx, cancel := context.WithCancel(s.ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		normal.base.Dequeue(ctx, "priority", "worker", func(ctx context.Context, data map[string]any, retry ...int) (int, error) {
+			handled.Add(1)
+			return 0, nil
+		})
+	}()
+
+	const rounds = 3
+	for round := 1; round <= rounds; round++ {
+		// let the consumer wait on every lane, then fill both of them at once
+		time.Sleep(200 * time.Millisecond)
+		_, err := s.client.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range p.keys {
+				pipe.XAdd(s.ctx, &redis.XAddArgs{Stream: key, Values: map[string]any{"timeToRun": "1m"}})
+			}
+			return nil
+		})
+		s.Require().NoError(err)
+		s.Eventually(func() bool { return handled.Load() == int64(2*round) }, 3*time.Second, 10*time.Millisecond,
+			"round %d: every message is handled", round)
+	}
+	for _, key := range p.keys {
+		s.Eventually(func() bool { return s.client.XPending(s.ctx, key, "priority").Val().Count == 0 },
+			time.Second, 10*time.Millisecond, "every message is acked")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		s.Fail("Dequeue doesn't stop, a worker is blocked")
+	}
+}
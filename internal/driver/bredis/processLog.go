@@ -11,20 +11,36 @@ import (
 )
 
 type ProcessLog struct {
-	client redis.UniversalClient
-	prefix string
+	client   redis.UniversalClient
+	prefix   string
+	maxLen   int64
+	migrated bool
 }
 
 func NewProcessLog(client redis.UniversalClient, prefix string) *ProcessLog {
 	return &ProcessLog{
 		client: client,
 		prefix: prefix,
+		maxLen: logicLogMaxLen,
 	}
 }
 
-func (t *ProcessLog) AddLog(ctx context.Context, data map[string]any) error {
+// SetMaxLen trim the logic log to about `maxLen` entries, the default is kept when it's not positive
+func (t *ProcessLog) SetMaxLen(maxLen int64) *ProcessLog {
+	if maxLen > 0 {
+		t.maxLen = maxLen
+	}
+	return t
+}
 
-	logStream := tool.MakeLogicKey(t.prefix)
+// SetMigrated count the logic log entries trimmed before the history has migrated them,
+// without a history nothing removes the entries and the trimming is expected
+func (t *ProcessLog) SetMigrated(migrated bool) *ProcessLog {
+	t.migrated = migrated
+	return t
+}
+
+func (t *ProcessLog) AddLog(ctx context.Context, data map[string]any) error {
 
 	moodType := btype.NORMAL
 
@@ -56,14 +72,8 @@ func (t *ProcessLog) AddLog(ctx context.Context, data map[string]any) error {
 
 	data["logType"] = bstatus.Logic
 	// write job log into redis
-	if err := t.client.XAdd(ctx, &redis.XAddArgs{
-		Stream:     logStream,
-		NoMkStream: false,
-		MaxLen:     20000,
-		Approx:     false,
-		ID:         "*",
-		Values:     data,
-	}).Err(); err != nil {
+	keys := []string{tool.MakeLogicKey(t.prefix), tool.MakeLogicTrimmedKey(t.prefix)}
+	if err := AddLogScript.Run(ctx, t.client, keys, scriptArgs(data, t.maxLen, t.migrated)...).Err(); err != nil {
 		return err
 	}
 
@@ -0,0 +1,58 @@
+package bredis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+// RedisSuite runs against the redis of env.json, the one `make test` starts with docker compose
+type RedisSuite struct {
+	suite.Suite
+	client redis.UniversalClient
+	ctx    context.Context
+	prefix string
+}
+
+func (s *RedisSuite) SetupSuite() {
+	vp := viper.New()
+	vp.SetConfigFile("../../../env.json")
+	s.Require().NoError(vp.ReadInConfig())
+
+	host := vp.GetString("redis.host")
+	if !strings.Contains(host, ":") {
+		host = strings.Join([]string{host, vp.GetString("redis.port")}, ":")
+	}
+	s.client = redis.NewClient(&redis.Options{
+		Addr:     host,
+		Password: vp.GetString("redis.password"),
+		DB:       vp.GetInt("redis.database"),
+	})
+	s.ctx = context.Background()
+	s.prefix = "bredis_suite"
+	if err := s.client.Ping(s.ctx).Err(); err != nil {
+		s.T().Skipf("redis is not available: %v", err)
+	}
+}
+
+func (s *RedisSuite) SetupTest() {
+	keys, err := s.client.Keys(s.ctx, "*"+s.prefix+"*").Result()
+	s.Require().NoError(err)
+	if len(keys) > 0 {
+		s.Require().NoError(s.client.Del(s.ctx, keys...).Err())
+	}
+}
+
+func (s *RedisSuite) TearDownSuite() {
+	if s.client != nil {
+		_ = s.client.Close()
+	}
+}
+
+func TestRedisSuite(t *testing.T) {
+	suite.Run(t, new(RedisSuite))
+}
@@ -2,10 +2,12 @@ package bredis
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
 	"github.com/retail-ai-inc/beanq/v4/helper/json"
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 	"github.com/retail-ai-inc/beanq/v4/helper/timex"
@@ -127,13 +129,39 @@ func (t *Schedule) Enqueue(ctx context.Context, data map[string]any) error {
 	priorityScore := priority / 1e3
 	priorityScore = cast.ToFloat64(msgExecuteTime) + priorityScore
 
-	zSetKey := tool.MakeZSetKey(t.base.prefix, channel, topic)
+	keys := []string{tool.MakeZSetKey(t.base.prefix, channel, topic)}
+	var mode string
+	var window time.Duration
 
-	if err := t.base.client.ZAdd(ctx, zSetKey, &redis.Z{Score: priorityScore, Member: bt}).Err(); err != nil {
+	if cast.ToString(data["collapseKey"]) != "" && cast.ToString(data["dedupKey"]) != "" {
+		return fmt.Errorf("dedup can't be combined with %s", data["collapseMode"])
+	}
+	if key := cast.ToString(data["collapseKey"]); key != "" {
+		collapseMode := btype.CollapseMode(cast.ToString(data["collapseMode"]))
+		if collapseMode != btype.DEBOUNCE && collapseMode != btype.THROTTLE {
+			return fmt.Errorf("unknown collapse mode: %s", collapseMode)
+		}
+		mode = collapseMode.String()
+		window = cast.ToDuration(data["collapseWindow"])
+		keys = append(keys, tool.MakeCollapseKey(t.base.prefix, channel, topic, mode, key))
+	} else if key := cast.ToString(data["dedupKey"]); key != "" {
+		mode = "dedup"
+		window = cast.ToDuration(data["dedupWindow"])
+		keys = append(keys, tool.MakeDedupKey(t.base.prefix, channel, topic, key))
+	}
+	keys, logMaxLen := t.base.publishKeys(keys...)
+
+	duplicate, err := EnqueueDelayScript.Run(ctx, t.base.client, keys,
+		scriptArgs(data, logMaxLen, t.base.logMigrated, mode, priorityScore, msgExecuteTime, priority/1e3, window.Milliseconds(), bt)...).Bool()
+	if err != nil {
 		return err
 	}
+	if duplicate {
+		return fmt.Errorf("dedup check: %w", bstatus.ErrIdempotent)
+	}
 
-	return err
+	t.base.publishedLog(ctx, logMaxLen, data)
+	return nil
 }
 
 func (t *Schedule) Dequeue(ctx context.Context, channel, topic string, do public.CallbackWithRetry) {
@@ -158,7 +186,6 @@ func (t *Schedule) PreWork(ctx context.Context, prefix string, channel, topic st
 	for {
 		select {
 		case <-ctx.Done():
-			_ = t.base.client.Close()
 			return
 		case <-timer.C:
 
@@ -7,14 +7,6 @@ import (
 )
 
 var (
-	//go:embed scripts/hashDuplicate.lua
-	hashDuplicateIdLua    string
-	HashDuplicateIdScript = redis.NewScript(hashDuplicateIdLua)
-
-	//go:embed scripts/sequenceByLock.lua
-	sequenceByLockLua    string
-	SequenceByLockScript = redis.NewScript(sequenceByLockLua)
-
 	//go:embed scripts/addLogicLock.lua
 	addLogicLockLua    string
 	AddLogicLockScript = redis.NewScript(addLogicLockLua)
@@ -34,4 +26,45 @@ var (
 	//go:embed scripts/changeGlobalStatus.lua
 	changeGlobalStatusLua    string
 	ChangeGlobalStatusScript = redis.NewScript(changeGlobalStatusLua)
+
+	//go:embed scripts/idempotentFinish.lua
+	idempotentFinishLua    string
+	IdempotentFinishScript = redis.NewScript(idempotentFinishLua)
+
+	//go:embed scripts/logicLog.lua
+	logicLogLua string
+
+	//go:embed scripts/addLog.lua
+	addLogLua    string
+	AddLogScript = redis.NewScript(logicLogLua + addLogLua)
+
+	//go:embed scripts/takeLogTrimmed.lua
+	takeLogTrimmedLua    string
+	TakeLogTrimmedScript = redis.NewScript(takeLogTrimmedLua)
+
+	// the enqueue scripts write the message and its published log at once
+	//go:embed scripts/enqueueNormal.lua
+	enqueueNormalLua    string
+	EnqueueNormalScript = redis.NewScript(logicLogLua + enqueueNormalLua)
+
+	//go:embed scripts/enqueueSequence.lua
+	enqueueSequenceLua    string
+	EnqueueSequenceScript = redis.NewScript(logicLogLua + enqueueSequenceLua)
+
+	//go:embed scripts/enqueueSequenceByLock.lua
+	enqueueSequenceByLockLua    string
+	EnqueueSequenceByLockScript = redis.NewScript(logicLogLua + enqueueSequenceByLockLua)
+
+	//go:embed scripts/enqueueDelay.lua
+	enqueueDelayLua    string
+	EnqueueDelayScript = redis.NewScript(logicLogLua + enqueueDelayLua)
 )
+
+// scriptArgs put `args` in front of the flattened message fields,
+// go-redis only flattens a map when it is the single argument of a script
+func scriptArgs(data map[string]any, args ...any) []any {
+	for k, v := range data {
+		args = append(args, k, v)
+	}
+	return args
+}
@@ -0,0 +1,10 @@
+-- KEYS: logic log, trimmed counter
+-- ARGV: log max length, migrated, fields...
+local log = {}
+for i = 3, #ARGV do
+    table.insert(log, ARGV[i])
+end
+
+addLogicLog(log)
+
+return true
@@ -0,0 +1,72 @@
+-- KEYS: zset, [dedup or collapse key], [logic log, trimmed counter]
+-- ARGV: log max length, migrated, mode (dedup, debounce, throttle or empty), score, execute time in ms,
+-- priority / 1e3, window in ms, member, fields...
+-- the score comes as a string, a lua number keeps 14 digits and would lose the priority
+local zsetKey = KEYS[1]
+local mode = ARGV[3]
+local score = ARGV[4]
+local now = tonumber(ARGV[5])
+local priority = tonumber(ARGV[6])
+local window = tonumber(ARGV[7])
+local member = ARGV[8]
+
+local message = {}
+for i = 9, #ARGV, 2 do
+    table.insert(message, ARGV[i])
+    table.insert(message, ARGV[i+1])
+end
+
+if mode == 'dedup' then
+    local ok = redis.call('SET', KEYS[2], '1', 'PX', window, 'NX')
+    if not ok then
+        return 1
+    end
+    redis.call('ZADD', zsetKey, score, member)
+
+elseif mode == 'debounce' then
+    -- collapse the messages of one key into the first pending delivery of the window,
+    -- the pending member is replaced so the last payload wins
+    local ttl = window
+    local pending = redis.call('GET', KEYS[2])
+    if pending then
+        local pendingScore = redis.call('ZSCORE', zsetKey, pending)
+        if pendingScore then
+            redis.call('ZREM', zsetKey, pending)
+            score = pendingScore
+            local pttl = redis.call('PTTL', KEYS[2])
+            if pttl > 0 then
+                ttl = pttl
+            end
+        end
+    end
+    redis.call('ZADD', zsetKey, score, member)
+    redis.call('SET', KEYS[2], member, 'PX', ttl)
+
+elseif mode == 'throttle' then
+    -- at most one message of a key is delivered per interval,
+    -- the messages published in between collapse into one delivery at the next slot
+    local throttleKey = KEYS[2]
+    local pending = redis.call('HGET', throttleKey, 'member')
+    local pendingScore = pending and redis.call('ZSCORE', zsetKey, pending)
+    if pendingScore then
+        redis.call('ZREM', zsetKey, pending)
+        redis.call('ZADD', zsetKey, pendingScore, member)
+        redis.call('HSET', throttleKey, 'member', member)
+    else
+        local slot = now
+        local nextSlot = tonumber(redis.call('HGET', throttleKey, 'next') or '0')
+        if nextSlot > slot then
+            slot = nextSlot
+        end
+        redis.call('ZADD', zsetKey, slot + priority, member)
+        redis.call('HSET', throttleKey, 'next', slot + window, 'member', member)
+        redis.call('PEXPIRE', throttleKey, slot + window - now)
+    end
+
+else
+    redis.call('ZADD', zsetKey, score, member)
+end
+
+addPublishedLog(message)
+
+return 0
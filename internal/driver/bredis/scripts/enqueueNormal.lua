@@ -0,0 +1,28 @@
+-- KEYS: stream, [dedup key], [logic log, trimmed counter]
+-- ARGV: log max length, migrated, dedup window in ms (0 without dedup key), stream max length, fields...
+local streamKey = KEYS[1]
+local window = tonumber(ARGV[3])
+local maxLen = tonumber(ARGV[4])
+
+if window > 0 then
+    local ok = redis.call('SET', KEYS[2], '1', 'PX', window, 'NX')
+    if not ok then
+        return 1
+    end
+end
+
+local message = {}
+for i = 5, #ARGV, 2 do
+    table.insert(message, ARGV[i])
+    table.insert(message, ARGV[i+1])
+end
+
+if maxLen > 0 then
+    redis.call('XADD', streamKey, 'MAXLEN', maxLen, '*', unpack(message))
+else
+    redis.call('XADD', streamKey, '*', unpack(message))
+end
+
+addPublishedLog(message)
+
+return 0
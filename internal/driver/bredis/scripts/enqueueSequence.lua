@@ -0,0 +1,34 @@
+-- KEYS: status key, stream, [logic log, trimmed counter]
+-- ARGV: log max length, migrated, fields...
+local key = KEYS[1]
+local streamKey = KEYS[2]
+
+local result = redis.pcall('HEXISTS',key,'id')
+
+if type(result) == 'table' and result.err then
+    return {err = result.err}
+end
+
+if result == 1 then
+    local hresult = redis.pcall('HINCRBY',key,'score',1)
+    if type(hresult) == 'table' and hresult.err then
+        return {err = hresult.err}
+    end
+    return 1
+end
+
+local message = {}
+for i = 3, #ARGV, 2 do
+    table.insert(message, ARGV[i])
+    table.insert(message, ARGV[i+1])
+end
+
+redis.call('XADD', streamKey, '*', unpack(message))
+
+redis.call('HSET', key, unpack(message))
+redis.call('HSET', key, 'status', 'published')
+redis.call('EXPIRE', key, 3600*6)
+
+addPublishedLog(message)
+
+return 0
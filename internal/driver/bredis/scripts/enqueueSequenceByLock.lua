@@ -0,0 +1,33 @@
+-- KEYS: stream, order key, data key, [logic log, trimmed counter]
+-- ARGV: log max length, migrated, order key ttl in seconds, fields...
+local streamKey = KEYS[1]
+local orderRediKey = KEYS[2]
+local dataKey = KEYS[3]
+local expireTime = tonumber(ARGV[3])
+
+local rediKeyStatus = redis.call('HGET',orderRediKey,"status")
+if rediKeyStatus == 'pending' then
+    return  {err = 'Locking'}
+end
+
+local message = {}
+for i = 4, #ARGV, 2 do
+    table.insert(message, ARGV[i])
+    table.insert(message, ARGV[i+1])
+end
+
+redis.call('XADD', streamKey, '*', unpack(message))
+redis.call('HSET',orderRediKey,unpack(message))
+redis.call('HSET',orderRediKey,'status','pending')
+
+if expireTime > 0 then
+    redis.call('EXPIRE',orderRediKey,expireTime)
+end
+
+redis.call('HSET', dataKey, unpack(message))
+redis.call('HSET', dataKey, 'status', 'published')
+redis.call('EXPIRE', dataKey, 3600*6)
+
+addPublishedLog(message)
+
+return true
@@ -0,0 +1,18 @@
+-- finish the claim of a message, only by the consumer holding it:
+-- keep `done` for the ttl when the handler has succeeded, release the claim otherwise
+local key = KEYS[1]
+local token = ARGV[1]
+local done = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+if redis.call('GET', key) ~= token then
+    return 0
+end
+
+if done == '' then
+    redis.call('DEL', key)
+else
+    redis.call('SET', key, done, 'PX', ttl)
+end
+
+return 1
@@ -0,0 +1,38 @@
+-- shared head of the scripts writing the logic log: the log and its trimmed counter are the last two KEYS,
+-- ARGV[1] is the length the log is trimmed to, 0 when the caller adds the log itself,
+-- and ARGV[2] is 1 when the log is migrated to a history
+
+-- addLogicLog the migrated entries are deleted from the log,
+-- so whatever the trimming removes has not reached the history yet and gets counted.
+-- Nothing is counted without a history, the trimming is all that bounds the log then.
+local function addLogicLog(fields)
+    local logMaxLen = tonumber(ARGV[1])
+    if logMaxLen <= 0 then
+        return
+    end
+    local logKey = KEYS[#KEYS - 1]
+    if ARGV[2] ~= '1' then
+        redis.call('XADD', logKey, 'MAXLEN', '~', logMaxLen, '*', unpack(fields))
+        return
+    end
+    local before = redis.call('XLEN', logKey)
+    redis.call('XADD', logKey, 'MAXLEN', '~', logMaxLen, '*', unpack(fields))
+    local trimmed = before + 1 - redis.call('XLEN', logKey)
+    if trimmed > 0 then
+        redis.call('HINCRBY', KEYS[#KEYS], 'total', trimmed)
+        redis.call('HINCRBY', KEYS[#KEYS], 'unreported', trimmed)
+    end
+end
+
+local function addPublishedLog(fields)
+    local log = {}
+    for i = 1, #fields do
+        log[i] = fields[i]
+    end
+    table.insert(log, 'status')
+    table.insert(log, 'published')
+    table.insert(log, 'logType')
+    table.insert(log, 'logic')
+    addLogicLog(log)
+end
+
@@ -0,0 +1,9 @@
+-- take the trimmed entries nobody has reported yet, the total stays for the dashboard
+local key = KEYS[1]
+
+local unreported = tonumber(redis.call('HGET', key, 'unreported') or '0')
+if unreported > 0 then
+    redis.call('HINCRBY', key, 'unreported', -unreported)
+end
+
+return unreported
@@ -60,7 +60,9 @@ func (t *Sequence) Enqueue(ctx context.Context, data map[string]any) error {
 
 	key := tool.MakeStatusKey(t.base.prefix, channel, topic, id)
 
-	exist, err := HashDuplicateIdScript.Run(ctx, t.base.client, []string{key, streamKey}, data).Bool()
+	keys, logMaxLen := t.base.publishKeys(key, streamKey)
+
+	exist, err := EnqueueSequenceScript.Run(ctx, t.base.client, keys, scriptArgs(data, logMaxLen, t.base.logMigrated)...).Bool()
 
 	if err != nil {
 		return err
@@ -69,6 +71,7 @@ func (t *Sequence) Enqueue(ctx context.Context, data map[string]any) error {
 		return fmt.Errorf("idempotency check: %w", bstatus.ErrIdempotent)
 	}
 
+	t.base.publishedLog(ctx, logMaxLen, data)
 	return nil
 }
 
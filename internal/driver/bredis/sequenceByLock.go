@@ -41,7 +41,7 @@ func (t *SequenceByLock) ForceUnlock(ctx context.Context, channel, topic, orderK
 
 func (t *SequenceByLock) Enqueue(ctx context.Context, data map[string]any) error {
 
-	channel, topic, orderKey, lockOrderKeyTTL := "", "", "", time.Duration(0)
+	channel, topic, orderKey, id, lockOrderKeyTTL := "", "", "", "", time.Duration(0)
 
 	if v, ok := data["channel"]; ok {
 		channel = cast.ToString(v)
@@ -52,17 +52,23 @@ func (t *SequenceByLock) Enqueue(ctx context.Context, data map[string]any) error
 	if v, ok := data["orderKey"]; ok {
 		orderKey = cast.ToString(v)
 	}
+	if v, ok := data["id"]; ok {
+		id = cast.ToString(v)
+	}
 	if v, ok := data["lockOrderKeyTTL"]; ok {
 		lockOrderKeyTTL = cast.ToDuration(v)
 	}
 	streamKey := tool.MakeStreamKey(t.base.subType, t.base.prefix, channel, topic)
 	orderRediKey := tool.MakeSequenceLockKey(t.base.prefix, channel, topic, orderKey)
+	dataKey := tool.MakeSequenceDataKey(t.base.prefix, channel, topic, id)
+	keys, logMaxLen := t.base.publishKeys(streamKey, orderRediKey, dataKey)
 
-	err := SequenceByLockScript.Run(ctx, t.base.client, []string{streamKey, orderRediKey, cast.ToString(lockOrderKeyTTL.Seconds())}, data).Err()
+	err := EnqueueSequenceByLockScript.Run(ctx, t.base.client, keys, scriptArgs(data, logMaxLen, t.base.logMigrated, lockOrderKeyTTL.Seconds())...).Err()
 	if err != nil {
 		return bstatus.SequentialLockError
 	}
 
+	t.base.publishedLog(ctx, logMaxLen, data)
 	return nil
 }
 
@@ -18,8 +18,9 @@ import (
 )
 
 type UITool struct {
-	client redis.UniversalClient
-	prefix string
+	client      redis.UniversalClient
+	connections []redis.UniversalClient
+	prefix      string
 }
 
 func NewUITool(client redis.UniversalClient, prefix string) *UITool {
@@ -30,6 +31,12 @@ func NewUITool(client redis.UniversalClient, prefix string) *UITool {
 	}
 }
 
+// SetConnections the other connections the streams are routed to, the dashboard counts their messages too
+func (t *UITool) SetConnections(connections ...redis.UniversalClient) *UITool {
+	t.connections = connections
+	return t
+}
+
 func (t *UITool) QueueMessage(ctx context.Context) error {
 
 	timer := timex.TimerPool.Get(5 * time.Second)
@@ -52,15 +59,17 @@ func (t *UITool) QueueMessage(ctx context.Context) error {
 		timer.Reset(5 * time.Second)
 		total, pending = 0, 0
 
-		// total data from all streams
-		streamkeys := t.client.Keys(ctx, strings.Join([]string{t.prefix, "*", ":stream"}, "")).Val()
+		// total data from all streams of all connections
+		for _, client := range append([]redis.UniversalClient{t.client}, t.connections...) {
+			streamkeys := client.Keys(ctx, strings.Join([]string{t.prefix, "*", ":stream"}, "")).Val()
 
-		for _, streamkey := range streamkeys {
-			val := t.client.XInfoGroups(ctx, streamkey).Val()
-			if len(val) > 0 {
-				pending += val[0].Pending
+			for _, streamkey := range streamkeys {
+				val := client.XInfoGroups(ctx, streamkey).Val()
+				if len(val) > 0 {
+					pending += val[0].Pending
+				}
+				total += client.XLen(ctx, streamkey).Val()
 			}
-			total += t.client.XLen(ctx, streamkey).Val()
 		}
 		if total <= 0 {
 			total = 0
@@ -2,6 +2,7 @@ package routers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"runtime"
 	"strings"
@@ -17,13 +18,14 @@ import (
 )
 
 type Dashboard struct {
-	client redis.UniversalClient
-	mog    *bmongo.BMongo
-	prefix string
+	client      redis.UniversalClient
+	connections map[string]redis.UniversalClient
+	mog         *bmongo.BMongo
+	prefix      string
 }
 
-func NewDashboard(client redis.UniversalClient, x *bmongo.BMongo, prefix string) *Dashboard {
-	return &Dashboard{client: client, mog: x, prefix: prefix}
+func NewDashboard(client redis.UniversalClient, connections map[string]redis.UniversalClient, x *bmongo.BMongo, prefix string) *Dashboard {
+	return &Dashboard{client: client, connections: connections, mog: x, prefix: prefix}
 }
 
 func (t *Dashboard) Nodes(w http.ResponseWriter, r *http.Request) {
@@ -125,19 +127,46 @@ func (t *Dashboard) Total(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	nodeId := r.URL.Query().Get("nodeId")
-	client := tool.ClientFac(t.client, t.prefix, nodeId)
-
-	// all keys
-	keys, err := client.Keys(ctx, strings.Join([]string{t.prefix, "*", "stream"}, ":"))
-	if err != nil {
-		result.Code = berror.InternalServerErrorCode
-		result.Msg = err.Error()
-		_ = result.Json(w, http.StatusInternalServerError)
-		return
+	connections := t.connections
+	if nodeId != "" {
+		// a node of the default cluster has been picked
+		connections = nil
 	}
 
-	// db size
-	dbSize, err := client.DbSize(ctx)
+	var (
+		queueTotal int
+		dbSize     int64
+		logTrimmed int64
+		reclaimed  int64
+	)
+	err := eachConnection(t.client, connections, func(name string, conn redis.UniversalClient) error {
+		client := tool.ClientFac(conn, t.prefix, nodeId)
+		// all keys
+		keys, err := client.Keys(ctx, strings.Join([]string{t.prefix, "*", "stream"}, ":"))
+		if err != nil {
+			return err
+		}
+		// db size
+		size, err := client.DbSize(ctx)
+		if err != nil {
+			return err
+		}
+		// logic log entries trimmed before they were migrated
+		trimmed, err := conn.HGet(ctx, tool.MakeLogicTrimmedKey(t.prefix), "total").Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		// pending messages reclaimed as dead letters
+		deadLetters, err := conn.HGet(ctx, tool.MakeDeadLetterReclaimedKey(t.prefix), "total").Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		queueTotal += len(keys)
+		dbSize += size
+		logTrimmed += trimmed
+		reclaimed += deadLetters
+		return nil
+	})
 	if err != nil {
 		result.Code = berror.InternalServerErrorCode
 		result.Msg = err.Error()
@@ -162,11 +191,13 @@ func (t *Dashboard) Total(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	result.Data = map[string]any{
-		"queue_total":   len(keys),
+		"queue_total":   queueTotal,
 		"db_size":       dbSize,
 		"num_cpu":       runtime.NumCPU(),
 		"fail_count":    failCount,
 		"success_count": successCount,
+		"log_trimmed":   logTrimmed,
+		"dead_letters":  reclaimed,
 	}
 	_ = result.Json(w, http.StatusOK)
 }
@@ -2,7 +2,6 @@ package routers
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/retail-ai-inc/beanq/v4/helper/berror"
@@ -10,9 +9,7 @@ import (
 	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
 	"github.com/retail-ai-inc/beanq/v4/helper/json"
 	"github.com/retail-ai-inc/beanq/v4/helper/response"
-	public "github.com/retail-ai-inc/beanq/v4/internal"
 	"github.com/retail-ai-inc/beanq/v4/internal/btype"
-	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/spf13/cast"
@@ -20,12 +17,13 @@ import (
 
 type Dlq struct {
 	client redis.UniversalClient
+	route  Route
 	prefix string
 	mgo    *bmongo.BMongo
 }
 
-func NewDlq(client redis.UniversalClient, mongo *bmongo.BMongo, prefix string) *Dlq {
-	return &Dlq{client: client, mgo: mongo, prefix: prefix}
+func NewDlq(client redis.UniversalClient, route Route, mongo *bmongo.BMongo, prefix string) *Dlq {
+	return &Dlq{client: client, route: route, mgo: mongo, prefix: prefix}
 }
 
 func (t *Dlq) List(w http.ResponseWriter, r *http.Request) {
@@ -114,15 +112,14 @@ func (t *Dlq) Retry(w http.ResponseWriter, r *http.Request) {
 	if v, ok := data["moodType"]; ok {
 		moodType = v.(string)
 	}
-
-	var bk public.IBroker
+	withoutPublishWindows(data)
 	if moodType == string(btype.SEQUENCE) {
 		_ = res.Json(w, http.StatusOK)
 		return
 	}
 	if moodType == string(btype.DELAY) {
 
-		bk = bredis.NewSchedule(t.client, t.prefix, 100, 10, 20*time.Minute, nil)
+		bk := routedBroker(t.client, t.route, t.prefix, btype.DELAY, data)
 		if err := bk.Enqueue(nctx, data); err != nil {
 			res.Msg = err.Error()
 			res.Code = berror.InternalServerErrorCode
@@ -133,7 +130,7 @@ func (t *Dlq) Retry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bk = bredis.NewNormal(t.client, t.prefix, 2000, 100, 10, 20, nil)
+	bk := routedBroker(t.client, t.route, t.prefix, btype.NORMAL, data)
 	if err := bk.Enqueue(nctx, data); err != nil {
 		res.Msg = err.Error()
 		res.Code = berror.InternalServerErrorCode
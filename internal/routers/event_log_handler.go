@@ -11,9 +11,7 @@ import (
 	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
 	"github.com/retail-ai-inc/beanq/v4/helper/json"
 	"github.com/retail-ai-inc/beanq/v4/helper/response"
-	public "github.com/retail-ai-inc/beanq/v4/internal"
 	"github.com/retail-ai-inc/beanq/v4/internal/btype"
-	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
 	"github.com/spf13/cast"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -21,12 +19,13 @@ import (
 type EventLog struct {
 	Id     string `json:"id"`
 	client redis.UniversalClient
+	route  Route
 	mogx   *bmongo.BMongo
 	prefix string
 }
 
-func NewEventLog(client redis.UniversalClient, x *bmongo.BMongo, prefix string) *EventLog {
-	return &EventLog{client: client, mogx: x, prefix: prefix}
+func NewEventLog(client redis.UniversalClient, route Route, x *bmongo.BMongo, prefix string) *EventLog {
+	return &EventLog{client: client, route: route, mogx: x, prefix: prefix}
 }
 
 func (t *EventLog) List(w http.ResponseWriter, r *http.Request) {
@@ -206,6 +205,7 @@ func (t *EventLog) Retry(w http.ResponseWriter, r *http.Request) {
 		data["retry"] = 0
 	}
 	delete(data, "runTime")
+	withoutPublishWindows(data)
 	uniqueId := ""
 	if v, ok := data["id"]; ok {
 		uniqueId = cast.ToString(v)
@@ -225,14 +225,13 @@ func (t *EventLog) Retry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var bk public.IBroker
 	if moodType == string(btype.SEQUENCE) {
 		_ = res.Json(w, http.StatusOK)
 		return
 	}
 	if moodType == string(btype.DELAY) {
 
-		bk = bredis.NewSchedule(t.client, t.prefix, 100, 10, 20*time.Minute, nil)
+		bk := routedBroker(t.client, t.route, t.prefix, btype.DELAY, data)
 		if err := bk.Enqueue(nctx, data); err != nil {
 			res.Msg = err.Error()
 			res.Code = berror.InternalServerErrorCode
@@ -243,7 +242,7 @@ func (t *EventLog) Retry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bk = bredis.NewNormal(t.client, t.prefix, 2000, 100, 10, 20*time.Minute, nil)
+	bk := routedBroker(t.client, t.route, t.prefix, btype.NORMAL, data)
 	if err := bk.Enqueue(nctx, data); err != nil {
 		res.Msg = err.Error()
 		res.Code = berror.InternalServerErrorCode
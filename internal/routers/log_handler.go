@@ -5,25 +5,26 @@ import (
 	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/retail-ai-inc/beanq/v4/helper/berror"
 	"github.com/retail-ai-inc/beanq/v4/helper/bmongo"
 	"github.com/retail-ai-inc/beanq/v4/helper/json"
 	"github.com/retail-ai-inc/beanq/v4/helper/response"
-	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
 	"github.com/spf13/cast"
 )
 
 type Log struct {
-	client redis.UniversalClient
-	mgo    *bmongo.BMongo
-	prefix string
+	client      redis.UniversalClient
+	connections map[string]redis.UniversalClient
+	route       Route
+	mgo         *bmongo.BMongo
+	prefix      string
 }
 
-func NewLog(client redis.UniversalClient, x *bmongo.BMongo, prefix string) *Log {
-	return &Log{client: client, mgo: x, prefix: prefix}
+func NewLog(client redis.UniversalClient, connections map[string]redis.UniversalClient, route Route, x *bmongo.BMongo, prefix string) *Log {
+	return &Log{client: client, connections: connections, route: route, mgo: x, prefix: prefix}
 }
 
 // del ,retry,archive,detail
@@ -86,7 +87,10 @@ func (t *Log) Delete(w http.ResponseWriter, r *http.Request) {
 	score := r.FormValue("score")
 	key := strings.Join([]string{t.prefix, "logs", msgType}, ":")
 
-	if err := ZRemRangeByScore(r.Context(), t.client, key, score, score); err != nil {
+	err := eachConnection(t.client, t.connections, func(name string, client redis.UniversalClient) error {
+		return ZRemRangeByScore(r.Context(), client, key, score, score)
+	})
+	if err != nil {
 		result.Code = berror.InternalServerErrorCode
 		result.Msg = err.Error()
 		_ = result.Json(w, http.StatusInternalServerError)
@@ -100,6 +104,11 @@ func (t *Log) Add(w http.ResponseWriter, r *http.Request) {
 
 // log detail
 func (t *Log) detailHandler(ctx context.Context, id, msgType string) (map[string]any, error) {
+	return t.find(ctx, id, msgType)
+}
+
+// find the log of id on the default connection or on the named ones
+func (t *Log) find(ctx context.Context, id, msgType string) (map[string]any, error) {
 
 	key := strings.Join([]string{t.prefix, "logs", msgType}, ":")
 
@@ -109,7 +118,15 @@ func (t *Log) detailHandler(ctx context.Context, id, msgType string) (map[string
 	build.WriteString(id)
 	build.WriteString("*")
 
-	vals, _, err := ZScan(ctx, t.client, key, 0, build.String(), 1)
+	var vals []string
+	err := eachConnection(t.client, t.connections, func(name string, client redis.UniversalClient) error {
+		if len(vals) > 0 {
+			return nil
+		}
+		var err error
+		vals, _, err = ZScan(ctx, client, key, 0, build.String(), 1)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -126,29 +143,13 @@ func (t *Log) detailHandler(ctx context.Context, id, msgType string) (map[string
 
 func (t *Log) retryHandler(ctx context.Context, id, msgType string) error {
 
-	key := strings.Join([]string{t.prefix, "logs", msgType}, ":")
-
-	var build strings.Builder
-	build.Grow(3)
-	build.WriteString("*")
-	build.WriteString(id)
-	build.WriteString("*")
-
-	keys, _, err := ZScan(ctx, t.client, key, 0, build.String(), 1)
+	data, err := t.find(ctx, id, msgType)
 	if err != nil {
 		return err
 	}
-	if len(keys) <= 0 {
-		return errors.New("record is empty")
-	}
-
-	var data map[string]any
-
-	if err := json.Unmarshal([]byte(keys[0]), &data); err != nil {
-		return err
-	}
+	withoutPublishWindows(data)
 
-	bk := bredis.NewSchedule(t.client, t.prefix, 100, 10, 20*time.Minute, nil)
+	bk := routedBroker(t.client, t.route, t.prefix, btype.DELAY, data)
 	if err := bk.Enqueue(ctx, data); err != nil {
 		return err
 	}
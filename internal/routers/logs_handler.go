@@ -15,12 +15,13 @@ import (
 )
 
 type Logs struct {
-	client redis.UniversalClient
-	prefix string
+	client      redis.UniversalClient
+	connections map[string]redis.UniversalClient
+	prefix      string
 }
 
-func NewLogs(client redis.UniversalClient, prefix string) *Logs {
-	return &Logs{client: client, prefix: prefix}
+func NewLogs(client redis.UniversalClient, connections map[string]redis.UniversalClient, prefix string) *Logs {
+	return &Logs{client: client, connections: connections, prefix: prefix}
 }
 
 func (t *Logs) List(w http.ResponseWriter, r *http.Request) {
@@ -47,8 +48,10 @@ func (t *Logs) List(w http.ResponseWriter, r *http.Request) {
 		matchStr = strings.Join([]string{t.prefix, "logs", "fail"}, ":")
 	}
 
+	// the logs of one connection are listed at a time, the default one without `connection`
+	conn := namedConnection(t.client, t.connections, r.FormValue("connection"))
 	nodeId := r.Header.Get("nodeId")
-	client := tool.ClientFac(t.client, t.prefix, nodeId)
+	client := tool.ClientFac(conn, t.prefix, nodeId)
 
 	data := make(map[string]any)
 	count, err := client.ZCard(r.Context(), matchStr)
@@ -60,7 +63,7 @@ func (t *Logs) List(w http.ResponseWriter, r *http.Request) {
 	}
 	data["total"] = count
 
-	keys, cursor, err := ZScan(r.Context(), t.client, matchStr, gCursor, "", 10)
+	keys, cursor, err := ZScan(r.Context(), conn, matchStr, gCursor, "", 10)
 
 	if err != nil {
 		resultRes.Code = "1005"
@@ -11,19 +11,20 @@ import (
 )
 
 type Queue struct {
-	client redis.UniversalClient
-	prefix string
+	client      redis.UniversalClient
+	connections map[string]redis.UniversalClient
+	prefix      string
 }
 
-func NewQueue(client redis.UniversalClient, prefix string) *Queue {
-	return &Queue{client: client, prefix: prefix}
+func NewQueue(client redis.UniversalClient, connections map[string]redis.UniversalClient, prefix string) *Queue {
+	return &Queue{client: client, connections: connections, prefix: prefix}
 }
 
 func (t *Queue) List(w http.ResponseWriter, r *http.Request) {
 	result, cancel := response.Get()
 	defer cancel()
 
-	bt, err := QueueInfo(r.Context(), t.client, t.prefix)
+	bt, err := QueueInfo(r.Context(), t.client, t.connections, t.prefix)
 	if err != nil {
 		result.Code = berror.InternalServerErrorCode
 		result.Msg = err.Error()
@@ -36,7 +37,8 @@ func (t *Queue) List(w http.ResponseWriter, r *http.Request) {
 
 }
 func (t *Queue) Detail(w http.ResponseWriter, r *http.Request) {
-	queueDetail(w, r, t.client, t.prefix)
+	key := strings.Join([]string{t.prefix, r.FormValue("id"), "normal_stream", "stream"}, ":")
+	queueDetail(w, r, connectionOf(r.Context(), t.client, t.connections, key), t.prefix)
 }
 
 func queueDetail(w http.ResponseWriter, r *http.Request, client redis.UniversalClient, prefix string) {
@@ -54,24 +54,27 @@ func (r *Router) HandleFunc(pattern string, handler HandleFunc, middles ...Middl
 func RouterList(fs2 fs.FS,
 	modFiles map[string]time.Time,
 	client redis.UniversalClient,
+	connections map[string]redis.UniversalClient,
+	route Route,
 	mgo *bmongo.BMongo,
 	workflowCollection *mongo.Collection,
+	workflowInspector WorkflowInspector,
 	prefix string, ui ui.Ui) *Router {
 
 	hdls := Handles{
-		schedule:     NewSchedule(client, prefix),
-		queue:        NewQueue(client, prefix),
-		logs:         NewLogs(client, prefix),
-		log:          NewLog(client, mgo, prefix),
+		schedule:     NewSchedule(client, connections, prefix),
+		queue:        NewQueue(client, connections, prefix),
+		logs:         NewLogs(client, connections, prefix),
+		log:          NewLog(client, connections, route, mgo, prefix),
 		redisInfo:    NewRedisInfo(client, prefix, mgo),
 		mongoInfo:    NewMongoInfo(mgo),
 		login:        NewLogin(client, mgo, prefix, ui),
 		client:       NewClient(client, prefix),
-		dashboard:    NewDashboard(client, mgo, prefix),
-		eventLog:     NewEventLog(client, mgo, prefix),
+		dashboard:    NewDashboard(client, connections, mgo, prefix),
+		eventLog:     NewEventLog(client, route, mgo, prefix),
 		user:         NewUser(client, mgo, prefix, ui),
-		dlq:          NewDlq(client, mgo, prefix),
-		workflow:     NewWorkFlow(workflowCollection),
+		dlq:          NewDlq(client, route, mgo, prefix),
+		workflow:     NewWorkFlow(workflowCollection, workflowInspector),
 		role:         NewRole(mgo),
 		pod:          NewPod(client, mgo, prefix),
 		sequenceLock: NewSequenceLock(client, prefix),
@@ -185,6 +188,12 @@ func RouterList(fs2 fs.FS,
 	router.HandleFunc("POST /dlq/delete", hdls.dlq.Delete, HeaderRule(), Auth(mgo, ui))
 	router.HandleFunc("GET /workflow/list", hdls.workflow.List, HeaderRule(), Auth(mgo, ui))
 	router.HandleFunc("POST /workflow/delete", hdls.workflow.Delete, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("GET /workflow/trans", hdls.workflow.TransList, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("GET /workflow/trans/{gid}", hdls.workflow.TransDetail, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("GET /workflow/trans/{gid}/timeline", hdls.workflow.Timeline, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("GET /workflow/trans/{gid}/branch/{index}", hdls.workflow.TransBranch, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("POST /workflow/trans/{gid}/compensate", hdls.workflow.Compensate, HeaderRule(), Auth(mgo, ui))
+	router.HandleFunc("POST /workflow/trans/{gid}/branch/{index}/succeed", hdls.workflow.SucceedBranch, HeaderRule(), Auth(mgo, ui))
 
 	router.HandleFunc("GET /pod/list", hdls.pod.List, HeaderRule(), Auth(mgo, ui))
 	router.HandleFunc("GET /mongo/detail", hdls.mongoInfo.Detail, HeaderRule(), Auth(mgo, ui))
@@ -1,6 +1,7 @@
 package routers
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -11,12 +12,13 @@ import (
 )
 
 type Schedule struct {
-	client redis.UniversalClient
-	prefix string
+	client      redis.UniversalClient
+	connections map[string]redis.UniversalClient
+	prefix      string
 }
 
-func NewSchedule(client redis.UniversalClient, prefix string) *Schedule {
-	return &Schedule{client: client, prefix: prefix}
+func NewSchedule(client redis.UniversalClient, connections map[string]redis.UniversalClient, prefix string) *Schedule {
+	return &Schedule{client: client, connections: connections, prefix: prefix}
 }
 
 func (t *Schedule) List(w http.ResponseWriter, r *http.Request) {
@@ -24,14 +26,27 @@ func (t *Schedule) List(w http.ResponseWriter, r *http.Request) {
 	result, cancel := response.Get()
 	defer cancel()
 
-	ctx := r.Context()
-
 	nodeId := r.Header.Get("X-Cluster-Nodeid")
-	client := tool.ClientFac(t.client, t.prefix, nodeId)
-
-	key := strings.Join([]string{t.prefix, "*", "delay_stream:stream"}, ":")
+	connections := t.connections
+	if nodeId != "" {
+		// a node of the default cluster has been picked
+		connections = nil
+	}
 
-	keys, err := client.Keys(ctx, key)
+	data := make(map[string][]Stream, 0)
+	err := eachConnection(t.client, connections, func(name string, client redis.UniversalClient) error {
+		streams, err := t.list(r.Context(), tool.ClientFac(client, t.prefix, nodeId))
+		if err != nil {
+			return err
+		}
+		for channel, list := range streams {
+			for i := range list {
+				list[i].Connection = name
+			}
+			data[channel] = append(data[channel], list...)
+		}
+		return nil
+	})
 	if err != nil {
 		result.Code = berror.InternalServerErrorCode
 		result.Msg = err.Error()
@@ -39,6 +54,19 @@ func (t *Schedule) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result.Data = data
+	_ = result.Json(w, http.StatusOK)
+}
+
+func (t *Schedule) list(ctx context.Context, client tool.IClient) (map[string][]Stream, error) {
+
+	key := strings.Join([]string{t.prefix, "*", "delay_stream:stream"}, ":")
+
+	keys, err := client.Keys(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
 	data := make(map[string][]Stream, 0)
 	for _, queue := range keys {
 
@@ -64,7 +92,5 @@ func (t *Schedule) List(w http.ResponseWriter, r *http.Request) {
 		}
 		data[arr[1]] = append(data[arr[1]], stream)
 	}
-
-	result.Data = data
-	_ = result.Json(w, http.StatusOK)
+	return data, nil
 }
@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/retail-ai-inc/beanq/v4/helper/json"
+	public "github.com/retail-ai-inc/beanq/v4/internal"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
+	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
 	"github.com/spf13/cast"
 )
 
@@ -149,16 +153,41 @@ type Msg struct {
 }
 
 type Stream struct {
-	Prefix   string `json:"prefix"`
-	Channel  string `json:"channel"`
-	Topic    string `json:"topic"`
-	MoodType string `json:"moodType"`
-	State    string `json:"state"`
-	Size     int    `json:"size"`
-	Idle     int    `json:"idle"`
+	// Connection the name of the redis connection the stream is routed to, empty for the default one
+	Connection string `json:"connection,omitempty"`
+	Prefix     string `json:"prefix"`
+	Channel    string `json:"channel"`
+	Topic      string `json:"topic"`
+	MoodType   string `json:"moodType"`
+	State      string `json:"state"`
+	Size       int    `json:"size"`
+	Idle       int    `json:"idle"`
 }
 
-func QueueInfo(ctx context.Context, client redis.UniversalClient, prefix string) (any, error) {
+// QueueInfo the streams of the default connection and of the named ones, grouped by channel
+func QueueInfo(ctx context.Context, client redis.UniversalClient, connections map[string]redis.UniversalClient, prefix string) (any, error) {
+
+	data := make(map[string][]Stream, 0)
+	err := eachConnection(client, connections, func(name string, client redis.UniversalClient) error {
+		streams, err := queueInfo(ctx, client, prefix)
+		if err != nil {
+			return err
+		}
+		for channel, list := range streams {
+			for i := range list {
+				list[i].Connection = name
+			}
+			data[channel] = append(data[channel], list...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func queueInfo(ctx context.Context, client redis.UniversalClient, prefix string) (map[string][]Stream, error) {
 
 	// get queues
 	cmd := client.Keys(ctx, QueueKey(prefix))
@@ -192,6 +221,58 @@ func QueueInfo(ctx context.Context, client redis.UniversalClient, prefix string)
 
 	return data, nil
 }
+
+// eachConnection call fn with the default client first, then with the named connections by name
+func eachConnection(client redis.UniversalClient, connections map[string]redis.UniversalClient, fn func(name string, client redis.UniversalClient) error) error {
+	if err := fn("", client); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fn(name, connections[name]); err != nil {
+			return fmt.Errorf("redis connection %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Route the broker of moodType on the connection channel and topic are routed to,
+// built the way the client builds it so a retried message is published like the original
+type Route func(moodType btype.MoodType, channel, topic string) public.IBroker
+
+// routedBroker the broker a retried message is enqueued with, a default one on client without routes
+func routedBroker(client redis.UniversalClient, route Route, prefix string, moodType btype.MoodType, data map[string]any) public.IBroker {
+	if route != nil {
+		return route(moodType, cast.ToString(data["channel"]), cast.ToString(data["topic"]))
+	}
+	if moodType == btype.DELAY {
+		return bredis.NewSchedule(client, prefix, 100, 10, 20*time.Minute, nil)
+	}
+	return bredis.NewNormal(client, prefix, 2000, 100, 10, 20*time.Minute, nil)
+}
+
+// namedConnection the connection called name, the default client for an empty or unknown name
+func namedConnection(client redis.UniversalClient, connections map[string]redis.UniversalClient, name string) redis.UniversalClient {
+	if conn, ok := connections[name]; ok {
+		return conn
+	}
+	return client
+}
+
+// connectionOf the connection holding key, the default client when none does
+func connectionOf(ctx context.Context, client redis.UniversalClient, connections map[string]redis.UniversalClient, key string) redis.UniversalClient {
+	for _, conn := range connections {
+		if n, err := conn.Exists(ctx, key).Result(); err == nil && n > 0 {
+			return conn
+		}
+	}
+	return client
+}
+
 func ScheduleQueueKey(prefix string) string {
 	return strings.Join([]string{prefix, "*", "zset"}, ":")
 }
@@ -215,3 +296,13 @@ func ReturnHtml(w http.ResponseWriter, errorString string) {
 	_, _ = w.Write([]byte(nhtml))
 	w.WriteHeader(http.StatusInternalServerError)
 }
+
+// withoutPublishWindows drop the dedup and collapse fields of a message,
+// a manual retry must not be swallowed by the publish dedup window or merged by debounce/throttle
+func withoutPublishWindows(data map[string]any) {
+	delete(data, "dedupKey")
+	delete(data, "dedupWindow")
+	delete(data, "collapseKey")
+	delete(data, "collapseMode")
+	delete(data, "collapseWindow")
+}
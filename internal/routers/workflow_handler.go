@@ -1,6 +1,9 @@
 package routers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"math"
 	"net/http"
 
@@ -13,12 +16,22 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// WorkflowInspector reads and repairs the workflow transactions, it's implemented by the beanq client
+type WorkflowInspector interface {
+	ListWorkflows(ctx context.Context, status, workflowType, position string, limit int64) (globals any, nextPosition string, err error)
+	// GetWorkflow the global and its branches ordered by index
+	GetWorkflow(ctx context.Context, gid string) (any, error)
+	ForceCompensate(ctx context.Context, gid, reason string) error
+	MarkBranchSucceeded(ctx context.Context, gid string, index int) error
+}
+
 type WorkFlow struct {
 	workflowCollection *mongo.Collection
+	inspector          WorkflowInspector
 }
 
-func NewWorkFlow(collection *mongo.Collection) *WorkFlow {
-	return &WorkFlow{workflowCollection: collection}
+func NewWorkFlow(collection *mongo.Collection, inspector WorkflowInspector) *WorkFlow {
+	return &WorkFlow{workflowCollection: collection, inspector: inspector}
 }
 
 func (t *WorkFlow) List(w http.ResponseWriter, r *http.Request) {
@@ -120,3 +133,233 @@ func (t *WorkFlow) Delete(w http.ResponseWriter, r *http.Request) {
 	res.Data = result.DeletedCount
 	_ = res.Json(w, http.StatusOK)
 }
+
+func (t *WorkFlow) TransList(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	query := r.URL.Query()
+	pageSize := cast.ToInt64(query.Get("pageSize"))
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	data, position, err := t.inspector.ListWorkflows(r.Context(), query.Get("status"), query.Get("type"), query.Get("cursor"), pageSize)
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	datas := make(map[string]any, 2)
+	datas["data"] = data
+	datas["cursor"] = position
+	result.Data = datas
+	_ = result.Json(w, http.StatusOK)
+}
+
+func (t *WorkFlow) TransDetail(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	data, err := t.inspector.GetWorkflow(r.Context(), r.PathValue("gid"))
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	result.Data = data
+	_ = result.Json(w, http.StatusOK)
+}
+
+// TransBranch the branch at `index` with the records of its attempts
+func (t *WorkFlow) TransBranch(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	ctx := r.Context()
+	gid := r.PathValue("gid")
+	index, err := cast.ToIntE(r.PathValue("index"))
+	if err != nil {
+		result.Code = berror.TypeErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusBadRequest)
+		return
+	}
+
+	branch, err := t.branch(ctx, gid, index)
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	records, err := t.records(ctx, bson.M{"Gid": gid, "TaskId": branch["task_id"], "Option": branch["op"]})
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	datas := make(map[string]any, 2)
+	datas["branch"] = branch
+	datas["records"] = records
+	result.Data = datas
+	_ = result.Json(w, http.StatusOK)
+}
+
+// Timeline the branches of a workflow in order, each one with its duration and the records of its attempts
+func (t *WorkFlow) Timeline(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	ctx := r.Context()
+	gid := r.PathValue("gid")
+
+	progress, err := t.progress(ctx, gid)
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	records, err := t.records(ctx, bson.M{"Gid": gid})
+	if err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+	grouped := make(map[string][]bson.M, len(progress.Branches))
+	for _, record := range records {
+		key := cast.ToString(record["TaskId"]) + "/" + cast.ToString(record["Option"])
+		grouped[key] = append(grouped[key], record)
+	}
+
+	for _, branch := range progress.Branches {
+		key := cast.ToString(branch["task_id"]) + "/" + cast.ToString(branch["op"])
+		if branchRecords, ok := grouped[key]; ok {
+			branch["records"] = branchRecords
+		} else {
+			branch["records"] = []bson.M{}
+		}
+
+		start, end := cast.ToTime(branch["start_time"]), cast.ToTime(branch["finish_time"])
+		if !start.IsZero() && !end.IsZero() {
+			branch["duration"] = end.Sub(start).Milliseconds()
+		}
+	}
+
+	datas := make(map[string]any, 3)
+	datas["global"] = progress.Global
+	datas["stuck"] = progress.Stuck
+	datas["branches"] = progress.Branches
+	result.Data = datas
+	_ = result.Json(w, http.StatusOK)
+}
+
+// records the workflow records matching filter in the order they were written, empty without mongo
+func (t *WorkFlow) records(ctx context.Context, filter bson.M) ([]bson.M, error) {
+	records := []bson.M{}
+	if t.workflowCollection == nil {
+		return records, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "CreatedAt", Value: 1}})
+	cursor, err := t.workflowCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = cursor.Close(ctx)
+	}()
+
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+type workflowProgress struct {
+	Global   map[string]any   `json:"global"`
+	Stuck    []map[string]any `json:"stuck"`
+	Branches []map[string]any `json:"branches"`
+}
+
+// progress round trip through json, the inspector hides the beanq types
+func (t *WorkFlow) progress(ctx context.Context, gid string) (*workflowProgress, error) {
+	data, err := t.inspector.GetWorkflow(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var progress workflowProgress
+	if err := json.Unmarshal(b, &progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+func (t *WorkFlow) branch(ctx context.Context, gid string, index int) (map[string]any, error) {
+	progress, err := t.progress(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(progress.Branches) {
+		return nil, errors.New("branch not found")
+	}
+	return progress.Branches[index], nil
+}
+
+func (t *WorkFlow) Compensate(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	if err := t.inspector.ForceCompensate(r.Context(), r.PathValue("gid"), r.PostFormValue("reason")); err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	_ = result.Json(w, http.StatusOK)
+}
+
+func (t *WorkFlow) SucceedBranch(w http.ResponseWriter, r *http.Request) {
+
+	result, cancel := response.Get()
+	defer cancel()
+
+	index, err := cast.ToIntE(r.PathValue("index"))
+	if err != nil {
+		result.Code = berror.TypeErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := t.inspector.MarkBranchSucceeded(r.Context(), r.PathValue("gid"), index); err != nil {
+		result.Code = berror.InternalServerErrorCode
+		result.Msg = err.Error()
+		_ = result.Json(w, http.StatusInternalServerError)
+		return
+	}
+
+	_ = result.Json(w, http.StatusOK)
+}
@@ -37,29 +37,39 @@ import (
 type (
 	TimeToRunLimit []time.Duration
 	Message        struct {
-		ExecuteTime     time.Time        `json:"executeTime"`
-		EndTime         time.Time        `json:"endTime"`
-		BeginTime       time.Time        `json:"beginTime"`
-		Response        any              `json:"response"`
-		Info            bstatus.FlagInfo `json:"info"`
-		Level           bstatus.LevelMsg `json:"level"`
-		Topic           string           `json:"topic"`
-		Channel         string           `json:"channel"`
-		OrderKey        string           `json:"orderKey"`
-		LockOrderKeyTTL time.Duration    `json:"lockOrderKeyTTL"`
-		Payload         string           `json:"payload"`
-		AddTime         string           `json:"addTime"`
-		Consumer        string           `json:"consumer"`
-		RunTime         string           `json:"runTime"`
-		MoodType        btype.MoodType   `json:"moodType"`
-		Status          bstatus.Status   `json:"status"`
-		Id              string           `json:"id"`
-		Retry           int              `json:"retry"`
-		TimeToRun       time.Duration    `json:"timeToRun"`
-		TimeToRunLimit  TimeToRunLimit   `json:"timeToRunLimit"`
-		MaxLen          int64            `json:"maxLen"`
-		Priority        float64          `json:"priority"`
-		PendingRetry    int64            `json:"pendingRetry"`
+		ExecuteTime     time.Time          `json:"executeTime"`
+		EndTime         time.Time          `json:"endTime"`
+		BeginTime       time.Time          `json:"beginTime"`
+		Response        any                `json:"response"`
+		Info            bstatus.FlagInfo   `json:"info"`
+		Level           bstatus.LevelMsg   `json:"level"`
+		Topic           string             `json:"topic"`
+		Channel         string             `json:"channel"`
+		OrderKey        string             `json:"orderKey"`
+		LockOrderKeyTTL time.Duration      `json:"lockOrderKeyTTL"`
+		Payload         string             `json:"payload"`
+		AddTime         string             `json:"addTime"`
+		Consumer        string             `json:"consumer"`
+		RunTime         string             `json:"runTime"`
+		MoodType        btype.MoodType     `json:"moodType"`
+		Status          bstatus.Status     `json:"status"`
+		Id              string             `json:"id"`
+		Retry           int                `json:"retry"`
+		TimeToRun       time.Duration      `json:"timeToRun"`
+		TimeToRunLimit  TimeToRunLimit     `json:"timeToRunLimit"`
+		MaxLen          int64              `json:"maxLen"`
+		Priority        float64            `json:"priority"`
+		PendingRetry    int64              `json:"pendingRetry"`
+		DedupKey        string             `json:"dedupKey"`
+		DedupWindow     time.Duration      `json:"dedupWindow"`
+		CollapseKey     string             `json:"collapseKey"`
+		CollapseMode    btype.CollapseMode `json:"collapseMode"`
+		CollapseWindow  time.Duration      `json:"collapseWindow"`
+		Chain           string             `json:"chain"`
+		// WorkflowGid the workflow a resumed message belongs to, the message id is the gid when empty
+		WorkflowGid string `json:"workflowGid"`
+		// ParentGid the workflow which published this one as a child
+		ParentGid string `json:"parentGid"`
 	}
 )
 
@@ -83,9 +93,34 @@ func (m Message) ToMap() map[string]any {
 	data["moodType"] = m.MoodType
 	data["timeToRun"] = m.TimeToRun
 	data["timeToRunLimit"] = m.TimeToRunLimit
+	if m.DedupKey != "" {
+		data["dedupKey"] = m.DedupKey
+		data["dedupWindow"] = m.DedupWindow
+	}
+	if m.CollapseKey != "" {
+		data["collapseKey"] = m.CollapseKey
+		data["collapseMode"] = m.CollapseMode
+		data["collapseWindow"] = m.CollapseWindow
+	}
+	if m.Chain != "" {
+		data["chain"] = m.Chain
+	}
+	if m.WorkflowGid != "" {
+		data["workflowGid"] = m.WorkflowGid
+	}
+	if m.ParentGid != "" {
+		data["parentGid"] = m.ParentGid
+	}
 	return data
 }
 
+func (m *Message) workflowGid() string {
+	if m.WorkflowGid != "" {
+		return m.WorkflowGid
+	}
+	return m.Id
+}
+
 func (t TimeToRunLimit) MarshalBinary() (data []byte, err error) {
 	return json.Marshal(t)
 }
@@ -157,6 +192,22 @@ func (data MessageM) ToMessage() *Message {
 			}
 		case "response":
 			msg.Response = val
+		case "dedupKey":
+			msg.DedupKey = cast.ToString(val)
+		case "dedupWindow":
+			msg.DedupWindow = cast.ToDuration(val)
+		case "collapseKey":
+			msg.CollapseKey = cast.ToString(val)
+		case "collapseMode":
+			msg.CollapseMode = btype.CollapseMode(cast.ToString(val))
+		case "collapseWindow":
+			msg.CollapseWindow = cast.ToDuration(val)
+		case "chain":
+			msg.Chain = cast.ToString(val)
+		case "workflowGid":
+			msg.WorkflowGid = cast.ToString(val)
+		case "parentGid":
+			msg.ParentGid = cast.ToString(val)
 		}
 	}
 	return msg
@@ -228,6 +279,30 @@ func (data MessageS) ToMessage() *Message {
 		if k == "response" {
 			msg.Response = v
 		}
+		if k == "dedupKey" {
+			msg.DedupKey = v
+		}
+		if k == "dedupWindow" {
+			msg.DedupWindow = cast.ToDuration(v)
+		}
+		if k == "collapseKey" {
+			msg.CollapseKey = v
+		}
+		if k == "collapseMode" {
+			msg.CollapseMode = btype.CollapseMode(v)
+		}
+		if k == "collapseWindow" {
+			msg.CollapseWindow = cast.ToDuration(v)
+		}
+		if k == "chain" {
+			msg.Chain = v
+		}
+		if k == "workflowGid" {
+			msg.WorkflowGid = v
+		}
+		if k == "parentGid" {
+			msg.ParentGid = v
+		}
 	}
 
 	return &msg
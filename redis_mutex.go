@@ -16,9 +16,11 @@ import (
 	"io"
 	mRand "math/rand" //nolint:gosec
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
+	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/hashicorp/go-multierror"
@@ -27,6 +29,9 @@ import (
 // ErrFailed is the error resulting if Redsync fails to acquire the lock after exhausting all retries.
 var ErrFailed = bstatus.BqError("failed to acquire lock")
 
+// ErrTaken is the error resulting if the lock is held by another owner on a quorum of the nodes.
+var ErrTaken = bstatus.BqError("lock already taken")
+
 // ErrExtendFailed is the error resulting if Redsync fails to extend the lock.
 var ErrExtendFailed = bstatus.BqError("failed to extend lock")
 
@@ -37,16 +42,21 @@ var ErrLockAlreadyExpired = bstatus.BqError("failed to unlock, lock was already
 type DelayFunc func(tries int) time.Duration
 
 type MuxClient struct {
-	client     redis.UniversalClient
+	clients    []redis.UniversalClient
 	prefix     string
 	expireTime time.Duration
 }
 
-func NewMuxClient(client redis.UniversalClient) *MuxClient {
+// NewMuxClient the locks are held on a majority of `clients`, give several independent masters
+// for a Redlock which survives the failure of a minority of them.
+func NewMuxClient(clients ...redis.UniversalClient) *MuxClient {
+	if len(clients) == 0 {
+		panic("mutex needs at least one redis client")
+	}
 	return &MuxClient{
 		expireTime: time.Second * 8,
 		prefix:     "mutex",
-		client:     client,
+		clients:    clients,
 	}
 }
 
@@ -62,9 +72,6 @@ func (p *MuxClient) SetExpireTime(expireTime time.Duration) *MuxClient {
 
 //nolint:gosec
 func (p *MuxClient) NewMutex(name string, options ...MuxOption) *Mutex {
-	pools := []redis.UniversalClient{
-		p.client,
-	}
 	m := &Mutex{
 		name:   strings.Join([]string{p.prefix, name}, ":"),
 		expiry: p.expireTime,
@@ -75,17 +82,18 @@ func (p *MuxClient) NewMutex(name string, options ...MuxOption) *Mutex {
 		genValueFunc:  genValue,
 		driftFactor:   0.01,
 		timeoutFactor: 0.1,
-		quorum:        len(pools)/2 + 1,
-		pools:         pools,
+		fenceTTL:      defaultFenceTTL,
+		pools:         append([]redis.UniversalClient{}, p.clients...),
 	}
 
 	for _, o := range options {
 		o.Apply(m)
 	}
+	m.quorum = len(m.pools)/2 + 1
 
 	if m.shuffle {
-		mRand.Shuffle(len(pools), func(i, j int) {
-			pools[i], pools[j] = pools[j], pools[i]
+		mRand.Shuffle(len(m.pools), func(i, j int) {
+			m.pools[i], m.pools[j] = m.pools[j], m.pools[i]
 		})
 	}
 	return m
@@ -94,6 +102,8 @@ func (p *MuxClient) NewMutex(name string, options ...MuxOption) *Mutex {
 // A Mutex is a distributed mutual exclusion lock.
 type Mutex struct {
 	until         time.Time
+	watchdog      context.CancelFunc
+	lost          chan struct{}
 	delayFunc     DelayFunc
 	genValueFunc  func() (string, error)
 	name          string
@@ -104,9 +114,12 @@ type Mutex struct {
 	timeoutFactor float64
 	quorum        int
 	expiry        time.Duration
+	fenceTTL      time.Duration
 	shuffle       bool
 	failFast      bool
 	setNXOnExtend bool
+	token         int64
+	mu            sync.Mutex
 }
 
 // Name returns mutex name (i.e. the Redis key).
@@ -121,9 +134,78 @@ func (m *Mutex) Value() string {
 
 // Until returns the time of validity of acquired lock. The value will be zero value until a lock is acquired.
 func (m *Mutex) Until() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.until
 }
 
+// Token returns the fencing token of the acquired lock, it's greater than the token of any previous holder,
+// so the downstream writes can reject a holder whose lock has expired. The value will be 0 until a lock is acquired.
+// The counter of an unused lock expires after the fence ttl and restarts from the clock, see WithFenceTTL.
+func (m *Mutex) Token() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// LockWithWatchdog locks m and keeps extending it in the background until it's unlocked or ctx is done,
+// it returns the fencing token of the lock. Lost is closed when the lock could not be extended in time.
+func (m *Mutex) LockWithWatchdog(ctx context.Context) (int64, error) {
+	if err := m.LockContext(ctx); err != nil {
+		return 0, err
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	lost := make(chan struct{})
+
+	m.mu.Lock()
+	m.watchdog = cancel
+	m.lost = lost
+	token := m.token
+	m.mu.Unlock()
+
+	go m.watch(wctx, lost)
+	return token, nil
+}
+
+// Lost is closed when the watchdog fails to keep the lock, it's nil without LockWithWatchdog.
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+func (m *Mutex) watch(ctx context.Context, lost chan struct{}) {
+	interval := m.expiry / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := m.ExtendContext(ctx)
+		if ok || ctx.Err() != nil {
+			continue
+		}
+		if time.Now().Before(m.Until()) {
+			// try again on the next tick while the lock is still valid
+			logger.New().Error(fmt.Errorf("extend lock %s: %w", m.name, err))
+			continue
+		}
+
+		logger.New().Error(fmt.Errorf("lock %s lost: %w", m.name, ErrExtendFailed))
+		close(lost)
+		return
+	}
+}
+
 // LockContext locks m. In case it returns an error on failure, you may retry to acquire the lock by calling this method again.
 func (m *Mutex) LockContext(ctx context.Context) error {
 	return m.lockContext(ctx, m.tries)
@@ -161,11 +243,25 @@ func (m *Mutex) lockContext(ctx context.Context, tries int) error {
 
 		start := time.Now()
 
+		var (
+			tokenMu sync.Mutex
+			token   int64
+		)
 		n, err := func() (int, error) {
 			ctx, cancel := context.WithTimeout(ctx, time.Duration(int64(float64(m.expiry)*m.timeoutFactor)))
 			defer cancel()
 			return m.actOnPoolsAsync(func(client redis.UniversalClient) (bool, error) {
-				return m.acquire(ctx, client, value)
+				t, err := m.acquire(ctx, client, value)
+				if err != nil || t == 0 {
+					return false, err
+				}
+				// the counters of the nodes may differ, the highest one is above every previous holder
+				tokenMu.Lock()
+				defer tokenMu.Unlock()
+				if t > token {
+					token = t
+				}
+				return true, nil
 			})
 		}()
 
@@ -173,8 +269,11 @@ func (m *Mutex) lockContext(ctx context.Context, tries int) error {
 		until := now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.driftFactor)))
 
 		if n >= m.quorum && now.Before(until) {
+			m.mu.Lock()
 			m.value = value
 			m.until = until
+			m.token = token
+			m.mu.Unlock()
 			return nil
 		}
 		_, _ = func() (int, error) {
@@ -194,6 +293,13 @@ func (m *Mutex) lockContext(ctx context.Context, tries int) error {
 
 // UnlockContext unlocks m and returns the status of unlock.
 func (m *Mutex) UnlockContext(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	if m.watchdog != nil {
+		m.watchdog()
+		m.watchdog = nil
+	}
+	m.mu.Unlock()
+
 	n, err := m.actOnPoolsAsync(func(client redis.UniversalClient) (bool, error) {
 		return m.release(ctx, client, m.value)
 	})
@@ -215,7 +321,9 @@ func (m *Mutex) ExtendContext(ctx context.Context) (bool, error) {
 	now := time.Now()
 	until := now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.driftFactor)))
 	if now.Before(until) {
+		m.mu.Lock()
 		m.until = until
+		m.mu.Unlock()
 		return true, nil
 	}
 	return false, ErrExtendFailed
@@ -230,12 +338,425 @@ func genValue() (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-func (m *Mutex) acquire(ctx context.Context, client redis.UniversalClient, value string) (bool, error) {
-	reply, err := client.SetNX(ctx, m.name, value, m.expiry).Result()
+// acquireScript sets the lock and increments its fencing counter.
+// The counter expires after the fence ttl, it restarts from the clock in microseconds so it still increases.
+var acquireScript = NewScript(2, `
+	if redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2], "NX") then
+		redis.call("SET", KEYS[2], ARGV[4], "NX")
+		local token = redis.call("INCR", KEYS[2])
+		redis.call("PEXPIRE", KEYS[2], ARGV[3])
+		return token
+	end
+	return 0
+`)
+
+// acquire returns the fencing token, 0 when the lock is taken
+func (m *Mutex) acquire(ctx context.Context, client redis.UniversalClient, value string) (int64, error) {
+	fenceTTL := m.fenceTTL
+	if fenceTTL < fenceTTLFactor*m.expiry {
+		fenceTTL = fenceTTLFactor * m.expiry
+	}
+	reply, err := m.Eval(ctx, client, acquireScript, m.name, m.fenceKey(), value, int(m.expiry/time.Millisecond),
+		fenceTTL.Milliseconds(), time.Now().UnixMicro())
+	if err != nil {
+		return 0, err
+	}
+	token, _ := reply.(int64)
+	return token, nil
+}
+
+// fenceKey lives in the hash slot of the lock key
+func (m *Mutex) fenceKey() string {
+	return slotKey(m.name, ":fence")
+}
+
+// slotKey a key in the hash slot of `name`, the whole name is the hash tag unless it has one
+func slotKey(name, suffix string) string {
+	if start := strings.Index(name, "{"); start >= 0 {
+		if end := strings.Index(name[start+1:], "}"); end > 0 {
+			return name + suffix
+		}
+	}
+	return "{" + name + "}" + suffix
+}
+
+// retry calls fn until it succeeds, the tries of m are exhausted or ctx is done
+func (m *Mutex) retry(ctx context.Context, fn func(ctx context.Context) (bool, error)) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var (
+		timer *time.Timer
+		err   error
+	)
+	for i := 0; i < m.tries; i++ {
+		if i != 0 {
+			if timer == nil {
+				timer = time.NewTimer(m.delayFunc(i))
+			} else {
+				timer.Reset(m.delayFunc(i))
+			}
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ErrFailed
+			case <-timer.C:
+			}
+		}
+
+		var ok bool
+		ok, err = func() (bool, error) {
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(int64(float64(m.expiry)*m.timeoutFactor)))
+			defer cancel()
+			return fn(ctx)
+		}()
+		if ok {
+			return nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	return ErrFailed
+}
+
+// until the validity of a lease taken at `start`
+func (m *Mutex) validity(start time.Time) time.Time {
+	now := time.Now()
+	return now.Add(m.expiry - now.Sub(start) - time.Duration(int64(float64(m.expiry)*m.driftFactor)))
+}
+
+// NewSemaphore a counting semaphore allowing `limit` holders of `name`, the waiters get it in arrival order.
+// It takes the prefix, expiry and retry options of the mutexes, it's kept on the first redis of the client only.
+func (p *MuxClient) NewSemaphore(name string, limit int, options ...MuxOption) *Semaphore {
+	return &Semaphore{
+		m:     p.NewMutex(name, options...),
+		limit: limit,
+	}
+}
+
+// A Semaphore is a distributed counting semaphore, every holder has a lease which expires unless it's extended.
+type Semaphore struct {
+	m     *Mutex
+	limit int
+}
+
+// Name returns semaphore name.
+func (s *Semaphore) Name() string {
+	return s.m.name
+}
+
+// Until returns the time of validity of the lease. The value will be zero value until the semaphore is acquired.
+func (s *Semaphore) Until() time.Time {
+	return s.m.Until()
+}
+
+// semaphoreAcquireScript the holders are scored by the expiry of their lease and the waiters by their ticket,
+// a waiter is admitted when it's among the first `limit - holders` ones and dropped when it stops asking.
+var semaphoreAcquireScript = NewScript(4, `
+	redis.replicate_commands()
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+	local expiry = tonumber(ARGV[2])
+	local limit = tonumber(ARGV[3])
+
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+	local stale = redis.call("ZRANGEBYSCORE", KEYS[3], "-inf", now - expiry)
+	for _, waiter in ipairs(stale) do
+		redis.call("ZREM", KEYS[2], waiter)
+		redis.call("ZREM", KEYS[3], waiter)
+	end
+	for i = 1, 4 do
+		redis.call("PEXPIRE", KEYS[i], expiry * 2)
+	end
+
+	if redis.call("ZSCORE", KEYS[1], ARGV[1]) then
+		redis.call("ZADD", KEYS[1], now + expiry, ARGV[1])
+		return 1
+	end
+	if not redis.call("ZSCORE", KEYS[2], ARGV[1]) then
+		redis.call("ZADD", KEYS[2], redis.call("INCR", KEYS[4]), ARGV[1])
+	end
+	redis.call("ZADD", KEYS[3], now, ARGV[1])
+
+	if redis.call("ZRANK", KEYS[2], ARGV[1]) < limit - redis.call("ZCARD", KEYS[1]) then
+		redis.call("ZADD", KEYS[1], now + expiry, ARGV[1])
+		redis.call("ZREM", KEYS[2], ARGV[1])
+		redis.call("ZREM", KEYS[3], ARGV[1])
+		redis.call("PEXPIRE", KEYS[1], expiry * 2)
+		return 1
+	end
+	return 0
+`)
+
+var semaphoreReleaseScript = NewScript(3, `
+	redis.call("ZREM", KEYS[2], ARGV[1])
+	redis.call("ZREM", KEYS[3], ARGV[1])
+	return redis.call("ZREM", KEYS[1], ARGV[1])
+`)
+
+var semaphoreTouchScript = NewScript(1, `
+	redis.replicate_commands()
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+	local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+	if not score or tonumber(score) <= now then
+		return 0
+	end
+	redis.call("ZADD", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+	redis.call("PEXPIRE", KEYS[1], tonumber(ARGV[2]) * 2)
+	return 1
+`)
+
+func (s *Semaphore) keys() []interface{} {
+	return []interface{}{
+		slotKey(s.m.name, ""),
+		slotKey(s.m.name, ":queue"),
+		slotKey(s.m.name, ":seen"),
+		slotKey(s.m.name, ":ticket"),
+	}
+}
+
+// AcquireContext waits for a free slot. When it gives up, it leaves the queue and returns ErrFailed.
+func (s *Semaphore) AcquireContext(ctx context.Context) error {
+	value, err := s.m.genValueFunc()
+	if err != nil {
+		return err
+	}
+	client := s.m.pools[0]
+	keys := s.keys()
+
+	var start time.Time
+	err = s.m.retry(ctx, func(ctx context.Context) (bool, error) {
+		start = time.Now()
+		status, err := s.m.Eval(ctx, client, semaphoreAcquireScript, append(keys, value, int(s.m.expiry/time.Millisecond), s.limit)...)
+		return status == int64(1), err
+	})
+	if err != nil {
+		_, _ = s.m.Eval(context.Background(), client, semaphoreReleaseScript, append(keys[:3:3], value)...)
+		return err
+	}
+
+	s.m.mu.Lock()
+	s.m.value = value
+	s.m.until = s.m.validity(start)
+	s.m.mu.Unlock()
+	return nil
+}
+
+// ReleaseContext frees the slot and returns whether it was still held.
+func (s *Semaphore) ReleaseContext(ctx context.Context) (bool, error) {
+	status, err := s.m.Eval(ctx, s.m.pools[0], semaphoreReleaseScript, append(s.keys()[:3:3], s.m.value)...)
+	if err != nil {
+		return false, err
+	}
+	if status == int64(0) {
+		return false, ErrLockAlreadyExpired
+	}
+	return true, nil
+}
+
+// ExtendContext resets the expiry of the lease.
+func (s *Semaphore) ExtendContext(ctx context.Context) (bool, error) {
+	start := time.Now()
+	status, err := s.m.Eval(ctx, s.m.pools[0], semaphoreTouchScript, slotKey(s.m.name, ""), s.m.value, int(s.m.expiry/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	if status != int64(1) {
+		return false, ErrExtendFailed
+	}
+
+	s.m.mu.Lock()
+	s.m.until = s.m.validity(start)
+	s.m.mu.Unlock()
+	return true, nil
+}
+
+// NewRWMutex a lock held by many readers or one writer, a waiting writer keeps new readers out.
+// It takes the prefix, expiry and retry options of the mutexes, it's kept on the first redis of the client only.
+func (p *MuxClient) NewRWMutex(name string, options ...MuxOption) *RWMutex {
+	return &RWMutex{m: p.NewMutex(name, options...)}
+}
+
+// A RWMutex is a distributed reader/writer mutual exclusion lock, one instance holds it once.
+type RWMutex struct {
+	m *Mutex
+}
+
+// Name returns rwmutex name.
+func (rw *RWMutex) Name() string {
+	return rw.m.name
+}
+
+// Until returns the time of validity of the acquired lock. The value will be zero value until a lock is acquired.
+func (rw *RWMutex) Until() time.Time {
+	return rw.m.Until()
+}
+
+// readLockScript the readers are scored by the expiry of their lease, the key lives as long as the last one
+var readLockScript = NewScript(3, `
+	redis.replicate_commands()
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+	if redis.call("EXISTS", KEYS[1]) == 1 or redis.call("EXISTS", KEYS[3]) == 1 then
+		return 0
+	end
+	redis.call("ZADD", KEYS[2], now + tonumber(ARGV[2]), ARGV[1])
+	local last = redis.call("ZRANGE", KEYS[2], -1, -1, "WITHSCORES")
+	redis.call("PEXPIREAT", KEYS[2], last[2])
+	return 1
+`)
+
+// writeLockScript a writer which has to wait leaves its intent, so no new reader comes in meanwhile
+var writeLockScript = NewScript(3, `
+	redis.replicate_commands()
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+	local intent = redis.call("GET", KEYS[3])
+	if intent and intent ~= ARGV[1] then
+		return 0
+	end
+	if redis.call("EXISTS", KEYS[1]) == 1 or redis.call("ZCARD", KEYS[2]) > 0 then
+		redis.call("SET", KEYS[3], ARGV[1], "PX", ARGV[2])
+		return 0
+	end
+
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	redis.call("DEL", KEYS[3])
+	return 1
+`)
+
+// readTouchScript a read lock is extended even while a writer waits, it's already held
+var readTouchScript = NewScript(1, `
+	redis.replicate_commands()
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+	local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+	if not score or tonumber(score) <= now then
+		return 0
+	end
+
+	redis.call("ZADD", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+	local last = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+	redis.call("PEXPIREAT", KEYS[1], last[2])
+	return 1
+`)
+
+var readUnlockScript = NewScript(1, `
+	return redis.call("ZREM", KEYS[1], ARGV[1])
+`)
+
+func (rw *RWMutex) keys() []interface{} {
+	return []interface{}{
+		slotKey(rw.m.name, ":w"),
+		slotKey(rw.m.name, ":r"),
+		slotKey(rw.m.name, ":wi"),
+	}
+}
+
+func (rw *RWMutex) lock(ctx context.Context, script *Script) error {
+	value, err := rw.m.genValueFunc()
+	if err != nil {
+		return err
+	}
+	client := rw.m.pools[0]
+	keys := rw.keys()
+
+	var start time.Time
+	err = rw.m.retry(ctx, func(ctx context.Context) (bool, error) {
+		start = time.Now()
+		status, err := rw.m.Eval(ctx, client, script, append(keys, value, int(rw.m.expiry/time.Millisecond))...)
+		return status == int64(1), err
+	})
+	if err != nil {
+		if script == writeLockScript {
+			// let the readers in again
+			_, _ = rw.m.Eval(context.Background(), client, deleteScript, keys[2], value)
+		}
+		return err
+	}
+
+	rw.m.mu.Lock()
+	rw.m.value = value
+	rw.m.until = rw.m.validity(start)
+	rw.m.mu.Unlock()
+	return nil
+}
+
+// RLockContext locks rw for reading, it waits while a writer holds it or is waiting for it.
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	return rw.lock(ctx, readLockScript)
+}
+
+// LockContext locks rw for writing, it waits until the readers and the writer have unlocked it.
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	return rw.lock(ctx, writeLockScript)
+}
+
+// RUnlockContext undoes a single RLockContext call.
+func (rw *RWMutex) RUnlockContext(ctx context.Context) (bool, error) {
+	status, err := rw.m.Eval(ctx, rw.m.pools[0], readUnlockScript, slotKey(rw.m.name, ":r"), rw.m.value)
+	if err != nil {
+		return false, err
+	}
+	if status == int64(0) {
+		return false, ErrLockAlreadyExpired
+	}
+	return true, nil
+}
+
+// UnlockContext undoes a LockContext call.
+func (rw *RWMutex) UnlockContext(ctx context.Context) (bool, error) {
+	status, err := rw.m.Eval(ctx, rw.m.pools[0], deleteScript, slotKey(rw.m.name, ":w"), rw.m.value)
 	if err != nil {
 		return false, err
 	}
-	return reply, nil
+	if status == int64(-1) {
+		return false, ErrLockAlreadyExpired
+	}
+	return status != int64(0), nil
+}
+
+// RExtendContext resets the expiry of the read lock.
+func (rw *RWMutex) RExtendContext(ctx context.Context) (bool, error) {
+	start := time.Now()
+	status, err := rw.m.Eval(ctx, rw.m.pools[0], readTouchScript, slotKey(rw.m.name, ":r"), rw.m.value, int(rw.m.expiry/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	if status != int64(1) {
+		return false, ErrExtendFailed
+	}
+
+	rw.m.mu.Lock()
+	rw.m.until = rw.m.validity(start)
+	rw.m.mu.Unlock()
+	return true, nil
+}
+
+// ExtendContext resets the expiry of the write lock.
+func (rw *RWMutex) ExtendContext(ctx context.Context) (bool, error) {
+	start := time.Now()
+	status, err := rw.m.Eval(ctx, rw.m.pools[0], touchScript, slotKey(rw.m.name, ":w"), rw.m.value, int(rw.m.expiry/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	if status == int64(0) {
+		return false, ErrExtendFailed
+	}
+
+	rw.m.mu.Lock()
+	rw.m.until = rw.m.validity(start)
+	rw.m.mu.Unlock()
+	return true, nil
 }
 
 var deleteScript = NewScript(1, `
@@ -352,13 +873,13 @@ func (m *Mutex) actOnPoolsAsync(actFn func(client redis.UniversalClient) (bool,
 
 			// fail fast
 			if len(taken) >= m.quorum {
-				return n, fmt.Errorf("lock already taken, locked nodes: %v", taken)
+				return n, fmt.Errorf("%w, locked nodes: %v", ErrTaken, taken)
 			}
 		}
 	}
 
 	if len(taken) >= m.quorum {
-		return n, fmt.Errorf("lock already taken, locked nodes: %v", taken)
+		return n, fmt.Errorf("%w, locked nodes: %v", ErrTaken, taken)
 	}
 	return n, err
 }
@@ -366,6 +887,10 @@ func (m *Mutex) actOnPoolsAsync(actFn func(client redis.UniversalClient) (bool,
 const (
 	minRetryDelayMilliSec = 50
 	maxRetryDelayMilliSec = 250
+
+	defaultFenceTTL = 24 * time.Hour
+	// the fencing counter outlives the lock by at least this factor
+	fenceTTLFactor = 10
 )
 
 // Script encapsulates the source, hash and key count for a Lua script.
@@ -416,6 +941,14 @@ func WithExpiry(expiry time.Duration) MuxOption {
 	})
 }
 
+// WithFenceTTL sets how long the fencing counter of an unused lock is kept, 24 hours by default.
+// It's kept at least 10 times the expiry of the lock.
+func WithFenceTTL(ttl time.Duration) MuxOption {
+	return OptionFunc(func(m *Mutex) {
+		m.fenceTTL = ttl
+	})
+}
+
 // WithTries can be used to set the number of times lock acquire is attempted.
 // The default value is 32.
 func WithTries(tries int) MuxOption {
@@ -491,6 +1024,16 @@ func WithFailFast(b bool) MuxOption {
 	})
 }
 
+// WithPools can be used to lock on other redis instances than the ones of the MuxClient,
+// the quorum is a majority of them.
+func WithPools(clients ...redis.UniversalClient) MuxOption {
+	return OptionFunc(func(m *Mutex) {
+		if len(clients) > 0 {
+			m.pools = append([]redis.UniversalClient{}, clients...)
+		}
+	})
+}
+
 // WithShufflePools can be used to shuffle Redis pools to reduce centralized access in concurrent scenarios.
 func WithShufflePools(b bool) MuxOption {
 	return OptionFunc(func(m *Mutex) {
@@ -1,35 +1,228 @@
-//go:build ci
-// +build ci
-
-// WARN: Please use `go test -tags ci ./...` instead of running `go test ./...` if you want to test this file.
 package beanq
 
 import (
-	"context"
-	"log"
-	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/spf13/viper"
-	"github.com/stretchr/testify/assert"
 )
 
-func TestLockContest(t *testing.T) {
-	viper.SetConfigFile("env.testing.json")
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatal(err)
+// downRedis a master which can't be reached
+func downRedis() redis.UniversalClient {
+	return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 50 * time.Millisecond})
+}
+
+func (s *RedisSuite) TestMutex_LockContext() {
+	mux := s.muxClient().NewMutex("test", WithExpiry(10*time.Second))
+	s.Require().NoError(mux.LockContext(s.ctx))
+
+	ok, err := mux.UnlockContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+}
+
+func (s *RedisSuite) TestMutex_Redlock() {
+	down := downRedis()
+	defer down.Close()
+
+	// one master failing still leaves a majority
+	client := s.muxClient(s.nodes[0], s.nodes[1], down)
+	mux := client.NewMutex("saga", WithTries(1))
+	s.Require().NoError(mux.LockContext(s.ctx), "the lock on 2 of 3 nodes")
+
+	other := client.NewMutex("saga", WithTries(1))
+	s.ErrorIs(other.LockContext(s.ctx), ErrTaken)
+
+	ok, err := mux.ExtendContext(s.ctx)
+	s.True(ok, "the lock is extended: %v", err)
+	ok, err = mux.UnlockContext(s.ctx)
+	s.True(ok, "the lock is released: %v", err)
+
+	// without a majority nobody gets the lock
+	minority := s.muxClient(s.nodes[0], down, downRedis())
+	s.Error(minority.NewMutex("saga", WithTries(1)).LockContext(s.ctx), "no lock on 1 of 3 nodes")
+	s.Zero(s.nodes[0].Exists(s.ctx, mux.Name()).Val(), "the failed attempt is released")
+
+	single := client.NewMutex("saga", WithTries(1), WithPools(s.nodes[0]))
+	s.NoError(single.LockContext(s.ctx), "the lock on the only pool")
+}
+
+func (s *RedisSuite) TestMutex_LockWithWatchdog() {
+	client := s.muxClient().SetExpireTime(100 * time.Millisecond)
+
+	mux := client.NewMutex("saga", WithTries(1), WithTimeoutFactor(0.5))
+	first, err := mux.LockWithWatchdog(s.ctx)
+	s.Require().NoError(err)
+
+	// the lock outlives its expiry while the watchdog runs
+	time.Sleep(300 * time.Millisecond)
+	other := client.NewMutex("saga", WithTries(1), WithTimeoutFactor(0.5))
+	s.Require().Error(other.LockContext(s.ctx), "the watchdog keeps the lock")
+
+	ok, err := mux.UnlockContext(s.ctx)
+	s.Require().True(ok, "the lock is released: %v", err)
+	s.Require().NoError(other.LockContext(s.ctx))
+	s.Greater(other.Token(), first, "the fencing token increases")
+
+	// without the watchdog the lock expires
+	time.Sleep(150 * time.Millisecond)
+	s.NoError(mux.LockContext(s.ctx), "the lock expires")
+}
+
+func (s *RedisSuite) TestMutex_Lost() {
+	node := newTestRedis(s.T(), 0)
+	lost := s.muxClient(node).SetExpireTime(100*time.Millisecond).NewMutex("lost", WithTries(1), WithTimeoutFactor(0.5))
+	_, err := lost.LockWithWatchdog(s.ctx)
+	s.Require().NoError(err)
+
+	// the watchdog reports the lock it could not keep
+	s.Require().NoError(node.Close())
+	select {
+	case <-lost.Lost():
+	case <-time.After(time.Second):
+		s.Fail("the lock is not reported lost")
+	}
+}
+
+func (s *RedisSuite) TestMutex_fenceKey() {
+	client := s.muxClient()
+	s.Equal("{"+s.prefix+":saga}:fence", client.NewMutex("saga").fenceKey(), "the lock name as hash tag")
+	s.Equal(s.prefix+":{order}:saga:fence", client.NewMutex("{order}:saga").fenceKey(), "the hash tag of the lock name")
+}
+
+func (s *RedisSuite) TestMutex_fence() {
+	// the fence ttl is at least 10 times the expiry
+	client := s.muxClient().SetExpireTime(20 * time.Millisecond)
+	mux := client.NewMutex("saga", WithTries(1), WithFenceTTL(200*time.Millisecond), WithTimeoutFactor(1))
+
+	before := time.Now().UnixMicro()
+	s.Require().NoError(mux.LockContext(s.ctx))
+	first := mux.Token()
+	s.Greater(first, before, "a new counter starts from the clock")
+	_, err := mux.UnlockContext(s.ctx)
+	s.Require().NoError(err)
+
+	ttl := s.nodes[0].PTTL(s.ctx, mux.fenceKey()).Val()
+	s.True(ttl > 0 && ttl <= 200*time.Millisecond, "the counter expires with the fence ttl, got: %v", ttl)
+
+	s.Require().NoError(mux.LockContext(s.ctx))
+	s.Equal(first+1, mux.Token(), "the counter is incremented while it lives")
+	_, err = mux.UnlockContext(s.ctx)
+	s.Require().NoError(err)
+
+	// the counter restarts once it has expired, and still increases
+	time.Sleep(250 * time.Millisecond)
+	s.Zero(s.nodes[0].Exists(s.ctx, mux.fenceKey()).Val())
+	s.Require().NoError(mux.LockContext(s.ctx))
+	s.Greater(mux.Token(), first+1)
+}
+
+func (s *RedisSuite) TestSemaphore() {
+	client := s.muxClient()
+	first := client.NewSemaphore("semaphore", 2, WithExpiry(10*time.Second))
+	second := client.NewSemaphore("semaphore", 2, WithExpiry(10*time.Second))
+	third := client.NewSemaphore("semaphore", 2, WithExpiry(10*time.Second), WithTries(2))
+
+	s.Require().NoError(first.AcquireContext(s.ctx))
+	s.Require().NoError(second.AcquireContext(s.ctx))
+	s.ErrorIs(third.AcquireContext(s.ctx), ErrFailed)
+
+	ok, err := first.ReleaseContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Require().NoError(third.AcquireContext(s.ctx))
+
+	ok, err = third.ExtendContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+
+	_, _ = second.ReleaseContext(s.ctx)
+	_, _ = third.ReleaseContext(s.ctx)
+}
+
+func (s *RedisSuite) TestSemaphore_expiry() {
+	client := s.muxClient()
+	holder := client.NewSemaphore("expiry", 1, WithExpiry(100*time.Millisecond))
+	waiter := client.NewSemaphore("expiry", 1, WithExpiry(10*time.Second), WithTries(1))
+
+	s.Require().NoError(holder.AcquireContext(s.ctx))
+	s.Require().ErrorIs(waiter.AcquireContext(s.ctx), ErrFailed)
+
+	// the holder stops extending its lease, its permit is reclaimed once it expires
+	time.Sleep(150 * time.Millisecond)
+	ok, err := holder.ExtendContext(s.ctx)
+	s.False(ok)
+	s.ErrorIs(err, ErrExtendFailed)
+	s.Require().NoError(waiter.AcquireContext(s.ctx), "the expired permit is reclaimed")
+
+	ok, err = holder.ReleaseContext(s.ctx)
+	s.False(ok)
+	s.ErrorIs(err, ErrLockAlreadyExpired, "the expired holder can't release the permit of another")
+	s.Equal(int64(1), s.nodes[0].ZCard(s.ctx, slotKey(waiter.Name(), "")).Val())
+}
+
+func (s *RedisSuite) TestRWMutex() {
+	client := s.muxClient()
+	reader1 := client.NewRWMutex("rw", WithExpiry(10*time.Second))
+	reader2 := client.NewRWMutex("rw", WithExpiry(10*time.Second))
+	writer := client.NewRWMutex("rw", WithExpiry(10*time.Second), WithTries(2))
+	reader3 := client.NewRWMutex("rw", WithExpiry(10*time.Second), WithTries(2))
+
+	s.Require().NoError(reader1.RLockContext(s.ctx))
+	s.Require().NoError(reader2.RLockContext(s.ctx))
+	s.ErrorIs(writer.LockContext(s.ctx), ErrFailed)
+
+	ok, err := reader1.RUnlockContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+	ok, err = reader2.RUnlockContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+
+	s.Require().NoError(writer.LockContext(s.ctx))
+	s.ErrorIs(reader3.RLockContext(s.ctx), ErrFailed)
+
+	ok, err = writer.UnlockContext(s.ctx)
+	s.Require().NoError(err)
+	s.True(ok)
+	s.NoError(reader3.RLockContext(s.ctx))
+	_, _ = reader3.RUnlockContext(s.ctx)
+}
+
+func (s *RedisSuite) TestRWMutex_writerWaits() {
+	client := s.muxClient()
+	reader := client.NewRWMutex("drain", WithExpiry(10*time.Second))
+	writer := client.NewRWMutex("drain", WithExpiry(10*time.Second), WithTries(100), WithRetryDelay(10*time.Millisecond))
+	late := client.NewRWMutex("drain", WithExpiry(10*time.Second), WithTries(1))
+
+	s.Require().NoError(reader.RLockContext(s.ctx))
+
+	locked := make(chan error, 1)
+	go func() {
+		locked <- writer.LockContext(s.ctx)
+	}()
+
+	// the waiting writer keeps new readers out
+	time.Sleep(50 * time.Millisecond)
+	s.ErrorIs(late.RLockContext(s.ctx), ErrFailed, "no new reader while a writer waits")
+	ok, err := reader.RExtendContext(s.ctx)
+	s.True(ok, "the reader in keeps its lock: %v", err)
+	select {
+	case err := <-locked:
+		s.Failf("the writer doesn't wait for the reader", "got: %v", err)
+	default:
 	}
-	var config BeanqConfig
-	err := viper.Unmarshal(&config)
-	assert.NoError(t, err)
-	client := New(&config)
-	muxClient := NewMuxClient(client.broker.client.(redis.UniversalClient))
-	mux := muxClient.NewMutex("test", WithExpiry(time.Second*10))
-	err = mux.LockContext(context.Background())
-	assert.NoError(t, err)
-
-	bl, err := mux.UnlockContext(context.Background())
-	assert.NoError(t, err)
-	assert.Equal(t, bl, true)
+
+	// the writer gets it once the readers have drained
+	_, err = reader.RUnlockContext(s.ctx)
+	s.Require().NoError(err)
+	select {
+	case err := <-locked:
+		s.Require().NoError(err)
+	case <-time.After(2 * time.Second):
+		s.FailNow("the writer doesn't get the lock")
+	}
+
+	_, err = writer.UnlockContext(s.ctx)
+	s.Require().NoError(err)
+	s.NoError(late.RLockContext(s.ctx), "the readers are let in again")
 }
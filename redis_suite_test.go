@@ -0,0 +1,116 @@
+package beanq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+// newTestRedis connects to database `db` of the redis of env.json, the one `make test` starts with docker compose,
+// the test is skipped when it's not available
+func newTestRedis(t *testing.T, db int) redis.UniversalClient {
+	t.Helper()
+	vp := viper.New()
+	vp.SetConfigFile("env.json")
+	if err := vp.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	host := vp.GetString("redis.host")
+	if !strings.Contains(host, ":") {
+		host = strings.Join([]string{host, vp.GetString("redis.port")}, ":")
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     host,
+		Password: vp.GetString("redis.password"),
+		DB:       vp.GetInt("redis.database") + db,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		_ = client.Close()
+		t.Skipf("redis is not available: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+// newTestMux the locks of a test on the test redis, their keys are removed after it
+func newTestMux(t *testing.T, prefix string) *MuxClient {
+	t.Helper()
+	client := newTestRedis(t, 0)
+	clean := func() {
+		keys, _ := client.Keys(context.Background(), "*"+prefix+"*").Result()
+		if len(keys) > 0 {
+			_ = client.Del(context.Background(), keys...).Err()
+		}
+	}
+	clean()
+	t.Cleanup(clean)
+	return NewMuxClient(client).SetPrefix(prefix)
+}
+
+// newTestConfig the config of env.json without history, its keys under `prefix` are removed after the test
+func newTestConfig(t *testing.T, prefix string) *BeanqConfig {
+	t.Helper()
+	client := newTestRedis(t, 0)
+	cfg, err := NewConfig("./", "json", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the config is shared by every NewConfig, change a copy
+	config := *cfg
+	config.History.On = false
+	config.Redis.Prefix = prefix
+	clean := func() {
+		keys, _ := client.Keys(context.Background(), prefix+"*").Result()
+		if len(keys) > 0 {
+			_ = client.Del(context.Background(), keys...).Err()
+		}
+	}
+	clean()
+	t.Cleanup(clean)
+	return &config
+}
+
+// RedisSuite runs the locks against three databases of the test redis, they stand in for independent masters
+type RedisSuite struct {
+	suite.Suite
+	ctx    context.Context
+	nodes  []redis.UniversalClient
+	prefix string
+}
+
+func (s *RedisSuite) SetupSuite() {
+	s.ctx = context.Background()
+	s.prefix = "beanq_mutex_test"
+	for db := 0; db < 3; db++ {
+		s.nodes = append(s.nodes, newTestRedis(s.T(), db))
+	}
+}
+
+func (s *RedisSuite) SetupTest() {
+	for _, node := range s.nodes {
+		keys, err := node.Keys(s.ctx, "*"+s.prefix+"*").Result()
+		s.Require().NoError(err)
+		if len(keys) > 0 {
+			s.Require().NoError(node.Del(s.ctx, keys...).Err())
+		}
+	}
+}
+
+// muxClient the locks of the test on `nodes`, the first node without any
+func (s *RedisSuite) muxClient(nodes ...redis.UniversalClient) *MuxClient {
+	if len(nodes) == 0 {
+		nodes = s.nodes[:1]
+	}
+	return NewMuxClient(nodes...).SetPrefix(s.prefix)
+}
+
+func TestRedisSuite(t *testing.T) {
+	suite.Run(t, new(RedisSuite))
+}
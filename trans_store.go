@@ -38,6 +38,9 @@ type TransStore interface {
 	MaySaveNew(ctx context.Context, global *TransGlobal, branches []TransBranch) error
 	LockGlobalSaveBranches(ctx context.Context, gid string, status string, branches []TransBranch, branchStart int) error
 	ChangeGlobalStatus(ctx context.Context, global *TransGlobal, newStatus string, updates []string, finished bool, finishedExpire time.Duration) error
+	SaveSignal(ctx context.Context, gid, name string, payload []byte) error
+	// FindSignal ok is false when the signal has not been sent
+	FindSignal(ctx context.Context, gid, name string) (payload []byte, ok bool, err error)
 }
 
 type transStore struct {
@@ -56,40 +59,49 @@ type TransGlobalScanCondition struct {
 }
 
 type TransGlobal struct {
-	Gid              string              `json:"gid,omitempty"`
-	TransType        string              `json:"trans_type,omitempty"`
-	Steps            []map[string]string `json:"steps,omitempty" gorm:"-"`
-	Payloads         []string            `json:"payloads,omitempty" gorm:"-"`
-	Status           string              `json:"status,omitempty"`
-	QueryPrepared    string              `json:"query_prepared,omitempty"`
-	FinishTime       *time.Time          `json:"finish_time,omitempty"`
-	RollbackTime     *time.Time          `json:"rollback_time,omitempty"`
-	Reason           string              `json:"reason,omitempty"`
-	Options          string              `json:"options,omitempty"`
-	CustomData       string              `json:"custom_data,omitempty"`
-	NextCronInterval time.Duration       `json:"next_cron_interval,omitempty"`
-	NextCronTime     *time.Time          `json:"next_cron_time,omitempty"`
-	Owner            string              `json:"owner,omitempty"`
-	CreateTime       *time.Time          `json:"create_time"`
-	UpdateTime       *time.Time          `json:"update_time"`
-	MessageData      string              `json:"message_data,omitempty"`
-	Message          *Message            `json:"-"`
+	Gid              string              `json:"gid,omitempty" bson:"gid"`
+	TransType        string              `json:"trans_type,omitempty" bson:"trans_type"`
+	Version          int                 `json:"version,omitempty" bson:"version"`
+	Steps            []map[string]string `json:"steps,omitempty" gorm:"-" bson:"steps"`
+	Payloads         []string            `json:"payloads,omitempty" gorm:"-" bson:"payloads"`
+	Status           string              `json:"status,omitempty" bson:"status"`
+	QueryPrepared    string              `json:"query_prepared,omitempty" bson:"query_prepared"`
+	FinishTime       *time.Time          `json:"finish_time,omitempty" bson:"finish_time"`
+	RollbackTime     *time.Time          `json:"rollback_time,omitempty" bson:"rollback_time"`
+	Reason           string              `json:"reason,omitempty" bson:"reason"`
+	Options          string              `json:"options,omitempty" bson:"options"`
+	CustomData       string              `json:"custom_data,omitempty" bson:"custom_data"`
+	NextCronInterval time.Duration       `json:"next_cron_interval,omitempty" bson:"next_cron_interval"`
+	NextCronTime     *time.Time          `json:"next_cron_time,omitempty" bson:"next_cron_time"`
+	Owner            string              `json:"owner,omitempty" bson:"owner"`
+	CreateTime       *time.Time          `json:"create_time" bson:"create_time"`
+	UpdateTime       *time.Time          `json:"update_time" bson:"update_time"`
+	MessageData      string              `json:"message_data,omitempty" bson:"message_data"`
+	Message          *Message            `json:"-" bson:"-"`
 }
 
 type TransBranch struct {
-	Index        int        `json:"index"`
-	Gid          string     `json:"gid,omitempty"`
-	TaskID       string     `json:"task_id,omitempty"`
-	Statement    string     `json:"url,omitempty"`
-	BinData      []byte     `json:"bin_data,omitempty"`
-	BranchID     string     `json:"branch_id,omitempty"`
-	Op           string     `json:"op,omitempty"`
-	Status       string     `json:"status,omitempty"`
-	FinishTime   *time.Time `json:"finish_time,omitempty"`
-	RollbackTime *time.Time `json:"rollback_time,omitempty"`
-	Error        string     `json:"error,omitempty"`
-	CreateTime   *time.Time `json:"create_time"`
-	UpdateTime   *time.Time `json:"update_time"`
+	Index        int        `json:"index" bson:"index"`
+	Gid          string     `json:"gid,omitempty" bson:"gid"`
+	TaskID       string     `json:"task_id,omitempty" bson:"task_id"`
+	Statement    string     `json:"url,omitempty" bson:"url"`
+	BinData      []byte     `json:"bin_data,omitempty" bson:"bin_data"`
+	BranchID     string     `json:"branch_id,omitempty" bson:"branch_id"`
+	Op           string     `json:"op,omitempty" bson:"op"`
+	Status       string     `json:"status,omitempty" bson:"status"`
+	FinishTime   *time.Time `json:"finish_time,omitempty" bson:"finish_time"`
+	RollbackTime *time.Time `json:"rollback_time,omitempty" bson:"rollback_time"`
+	Error        string     `json:"error,omitempty" bson:"error"`
+	CreateTime   *time.Time `json:"create_time" bson:"create_time"`
+	UpdateTime   *time.Time `json:"update_time" bson:"update_time"`
+	// DependsOn task ids whose actions must succeed first, nil means the previous task (saved before DAG support)
+	DependsOn []string `json:"depends_on" bson:"depends_on"`
+	// StartTime when the branch was first run, FinishTime - StartTime is how long it took
+	StartTime *time.Time `json:"start_time,omitempty" bson:"start_time"`
+	// WaitUntil deadline of a task waiting for a signal, set when the task is reached
+	WaitUntil *time.Time `json:"wait_until,omitempty" bson:"wait_until"`
+	// ChildGid the child workflow published by the task
+	ChildGid string `json:"child_gid,omitempty" bson:"child_gid"`
 }
 
 func NewTransStore(client redis.UniversalClient, prefix string, dataExpire time.Duration) *transStore {
@@ -149,10 +161,7 @@ func (t *transStore) ScanGlobals(ctx context.Context, position *string, limit in
 					return nil, err
 				}
 
-				if (condition.Status == "" || global.Status == condition.Status) &&
-					(condition.TransType == "" || global.TransType == condition.TransType) &&
-					(condition.CreateTimeStart.IsZero() || global.CreateTime.After(condition.CreateTimeStart)) &&
-					(condition.CreateTimeEnd.IsZero() || global.CreateTime.Before(condition.CreateTimeEnd)) {
+				if matchTransGlobal(global, condition) {
 					globals = append(globals, global)
 				}
 
@@ -268,6 +277,31 @@ func (t *transStore) ChangeGlobalStatus(
 	return handleRedisResult(ret, err)
 }
 
+func (t *transStore) SaveSignal(ctx context.Context, gid, name string, payload []byte) error {
+	n, err := t.client.Exists(ctx, t.prefix+":g:"+gid).Result()
+	if err != nil {
+		return fmt.Errorf("[transStore.SaveSignal] exists failed: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if err := t.client.Set(ctx, t.prefix+":sig:"+gid+":"+name, payload, t.expire).Err(); err != nil {
+		return fmt.Errorf("[transStore.SaveSignal] set failed: %w", err)
+	}
+	return nil
+}
+
+func (t *transStore) FindSignal(ctx context.Context, gid, name string) ([]byte, bool, error) {
+	payload, err := t.client.Get(ctx, t.prefix+":sig:"+gid+":"+name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("[transStore.FindSignal] get failed: %w", err)
+	}
+	return payload, true, nil
+}
+
 func handleRedisResult(ret interface{}, err error) error {
 	if err == nil {
 		return nil
@@ -374,7 +408,7 @@ func NewTransGlobal(message *Message) (*TransGlobal, error) {
 		Message: message,
 	}
 
-	t.Gid = t.Message.Id
+	t.Gid = t.Message.workflowGid()
 	t.TransType = "workflow"
 	t.Status = StatusPrepared
 
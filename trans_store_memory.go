@@ -0,0 +1,185 @@
+package beanq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryTransStore keeps the transactions in process, it's meant for testing saga logic without Redis.
+// Data never expires.
+type memoryTransStore struct {
+	globals  map[string]TransGlobal
+	branches map[string][]TransBranch
+	signals  map[string][]byte
+	mu       sync.Mutex
+}
+
+var _ TransStore = (*memoryTransStore)(nil)
+
+func NewMemoryTransStore() *memoryTransStore {
+	return &memoryTransStore{
+		globals:  make(map[string]TransGlobal),
+		branches: make(map[string][]TransBranch),
+		signals:  make(map[string][]byte),
+	}
+}
+
+func (t *memoryTransStore) FindGlobal(ctx context.Context, gid string) (*TransGlobal, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	global, ok := t.globals[gid]
+	if !ok {
+		return nil, nil
+	}
+	return &global, nil
+}
+
+func (t *memoryTransStore) ScanGlobals(ctx context.Context, position *string, limit int64, condition TransGlobalScanCondition) ([]TransGlobal, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the position is the last gid returned, like the _id of the mongo store
+	var after string
+	if position != nil {
+		after = *position
+	}
+	gids := make([]string, 0, len(t.globals))
+	for gid := range t.globals {
+		if gid > after {
+			gids = append(gids, gid)
+		}
+	}
+	sort.Strings(gids)
+
+	var globals []TransGlobal
+	next := ""
+	for i, gid := range gids {
+		global := t.globals[gid]
+		if matchTransGlobal(global, condition) {
+			globals = append(globals, global)
+		}
+		if int64(len(globals)) >= limit {
+			if i < len(gids)-1 {
+				next = gid
+			}
+			break
+		}
+	}
+
+	if position != nil {
+		*position = next
+	}
+	return globals, nil
+}
+
+func (t *memoryTransStore) FindBranches(ctx context.Context, gid string) ([]TransBranch, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]TransBranch{}, t.branches[gid]...), nil
+}
+
+func (t *memoryTransStore) MaySaveNew(ctx context.Context, global *TransGlobal, branches []TransBranch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.globals[global.Gid]; ok {
+		return ErrUniqueConflict
+	}
+
+	global.Steps = nil
+	global.Payloads = nil
+
+	t.globals[global.Gid] = *global
+	t.branches[global.Gid] = append([]TransBranch{}, branches...)
+	return nil
+}
+
+func (t *memoryTransStore) LockGlobalSaveBranches(ctx context.Context, gid string, status string, branches []TransBranch, branchStart int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	global, ok := t.globals[gid]
+	if !ok || global.Status != status {
+		return ErrNotFound
+	}
+
+	saved := t.branches[gid]
+	if branchStart == -1 {
+		for _, b := range saved {
+			if len(branches) > 0 && b.BranchID == branches[0].BranchID && b.Op == branches[0].Op {
+				return ErrUniqueConflict
+			}
+		}
+		t.branches[gid] = append(saved, branches...)
+		return nil
+	}
+
+	for k, b := range branches {
+		if branchStart+k >= len(saved) {
+			return fmt.Errorf("[memoryTransStore.LockGlobalSaveBranches] index %d out of range", branchStart+k)
+		}
+		saved[branchStart+k] = b
+	}
+	return nil
+}
+
+func (t *memoryTransStore) ChangeGlobalStatus(ctx context.Context, global *TransGlobal, newStatus string, updates []string, finished bool, finishedExpire time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	saved, ok := t.globals[global.Gid]
+	if !ok || saved.Status != global.Status {
+		return ErrNotFound
+	}
+
+	global.Status = newStatus
+	saved.Status = newStatus
+	setGlobalFields(&saved, global, updates)
+	t.globals[global.Gid] = saved
+	return nil
+}
+
+// setGlobalFields copy the fields named by their json tag in `updates` from `global` onto `saved`
+func setGlobalFields(saved, global *TransGlobal, updates []string) {
+	to, from := reflect.ValueOf(saved).Elem(), reflect.ValueOf(global).Elem()
+	for i := 0; i < to.NumField(); i++ {
+		name, _, _ := strings.Cut(to.Type().Field(i).Tag.Get("json"), ",")
+		if slices.Contains(updates, name) {
+			to.Field(i).Set(from.Field(i))
+		}
+	}
+}
+
+func (t *memoryTransStore) SaveSignal(ctx context.Context, gid, name string, payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.globals[gid]; !ok {
+		return ErrNotFound
+	}
+	t.signals[gid+":"+name] = append([]byte{}, payload...)
+	return nil
+}
+
+func (t *memoryTransStore) FindSignal(ctx context.Context, gid, name string) ([]byte, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	payload, ok := t.signals[gid+":"+name]
+	return payload, ok, nil
+}
+
+func matchTransGlobal(global TransGlobal, condition TransGlobalScanCondition) bool {
+	return (condition.Status == "" || global.Status == condition.Status) &&
+		(condition.TransType == "" || global.TransType == condition.TransType) &&
+		(condition.CreateTimeStart.IsZero() || global.CreateTime.After(condition.CreateTimeStart)) &&
+		(condition.CreateTimeEnd.IsZero() || global.CreateTime.Before(condition.CreateTimeEnd))
+}
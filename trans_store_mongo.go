@@ -0,0 +1,243 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoTransStore keeps one document per transaction with the branches embedded,
+// unfinished transactions never expire.
+type mongoTransStore struct {
+	collection *mongo.Collection
+}
+
+var _ TransStore = (*mongoTransStore)(nil)
+
+type mongoTrans struct {
+	TransGlobal `bson:",inline"`
+	ID          string            `bson:"_id"`
+	Branches    []TransBranch     `bson:"branches"`
+	Signals     map[string][]byte `bson:"signals,omitempty"`
+	ExpireAt    *time.Time        `bson:"expire_at,omitempty"`
+}
+
+// NewMongoTransStore the finished transactions are removed by a TTL index on `expire_at`
+func NewMongoTransStore(ctx context.Context, collection *mongo.Collection) (*mongoTransStore, error) {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expire_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[mongoTransStore] create indexes failed: %w", err)
+	}
+	return &mongoTransStore{collection: collection}, nil
+}
+
+func (t *mongoTransStore) FindGlobal(ctx context.Context, gid string) (*TransGlobal, error) {
+	var trans mongoTrans
+	err := t.collection.FindOne(ctx, bson.M{"_id": gid}, options.FindOne().SetProjection(bson.M{"branches": 0})).Decode(&trans)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[mongoTransStore.FindGlobal] find failed: %w", err)
+	}
+	return &trans.TransGlobal, nil
+}
+
+// ScanGlobals position is the _id of the last document returned, the next page starts after it
+// so the globals changing status in between don't shift the pages.
+func (t *mongoTransStore) ScanGlobals(ctx context.Context, position *string, limit int64, condition TransGlobalScanCondition) ([]TransGlobal, error) {
+	filter := bson.M{}
+	if position != nil && *position != "" {
+		filter["_id"] = bson.M{"$gt": *position}
+	}
+	if condition.Status != "" {
+		filter["status"] = condition.Status
+	}
+	if condition.TransType != "" {
+		filter["trans_type"] = condition.TransType
+	}
+	createTime := bson.M{}
+	if !condition.CreateTimeStart.IsZero() {
+		createTime["$gt"] = condition.CreateTimeStart
+	}
+	if !condition.CreateTimeEnd.IsZero() {
+		createTime["$lt"] = condition.CreateTimeEnd
+	}
+	if len(createTime) > 0 {
+		filter["create_time"] = createTime
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"branches": 0}).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(limit)
+	cursor, err := t.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("[mongoTransStore.ScanGlobals] find failed: %w", err)
+	}
+
+	var docs []mongoTrans
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("[mongoTransStore.ScanGlobals] decode failed: %w", err)
+	}
+
+	globals := make([]TransGlobal, 0, len(docs))
+	for _, doc := range docs {
+		globals = append(globals, doc.TransGlobal)
+	}
+
+	if position != nil {
+		*position = ""
+		if int64(len(docs)) == limit {
+			*position = docs[len(docs)-1].ID
+		}
+	}
+	return globals, nil
+}
+
+func (t *mongoTransStore) FindBranches(ctx context.Context, gid string) ([]TransBranch, error) {
+	var trans mongoTrans
+	err := t.collection.FindOne(ctx, bson.M{"_id": gid}, options.FindOne().SetProjection(bson.M{"branches": 1})).Decode(&trans)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return []TransBranch{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[mongoTransStore.FindBranches] find failed: %w", err)
+	}
+	return trans.Branches, nil
+}
+
+func (t *mongoTransStore) MaySaveNew(ctx context.Context, global *TransGlobal, branches []TransBranch) error {
+	global.Steps = nil
+	global.Payloads = nil
+
+	_, err := t.collection.InsertOne(ctx, mongoTrans{
+		TransGlobal: *global,
+		ID:          global.Gid,
+		Branches:    branches,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUniqueConflict
+	}
+	if err != nil {
+		return fmt.Errorf("[mongoTransStore.MaySaveNew] insert failed: %w", err)
+	}
+	return nil
+}
+
+func (t *mongoTransStore) LockGlobalSaveBranches(ctx context.Context, gid string, status string, branches []TransBranch, branchStart int) error {
+	filter := bson.M{"_id": gid, "status": status}
+	var update bson.M
+
+	if branchStart == -1 {
+		if len(branches) > 0 {
+			filter["branches"] = bson.M{"$not": bson.M{"$elemMatch": bson.M{"branch_id": branches[0].BranchID, "op": branches[0].Op}}}
+		}
+		update = bson.M{"$push": bson.M{"branches": bson.M{"$each": branches}}}
+	} else {
+		set := bson.M{}
+		for k, b := range branches {
+			set[fmt.Sprintf("branches.%d", branchStart+k)] = b
+		}
+		update = bson.M{"$set": set}
+	}
+
+	ret, err := t.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("[mongoTransStore.LockGlobalSaveBranches] update failed: %w", err)
+	}
+	if ret.MatchedCount > 0 {
+		return nil
+	}
+
+	if branchStart == -1 {
+		// tell a duplicated branch from a changed global status
+		n, err := t.collection.CountDocuments(ctx, bson.M{"_id": gid, "status": status})
+		if err != nil {
+			return fmt.Errorf("[mongoTransStore.LockGlobalSaveBranches] count failed: %w", err)
+		}
+		if n > 0 {
+			return ErrUniqueConflict
+		}
+	}
+	return ErrNotFound
+}
+
+func (t *mongoTransStore) ChangeGlobalStatus(
+	ctx context.Context,
+	global *TransGlobal,
+	newStatus string,
+	updates []string,
+	finished bool,
+	finishedExpire time.Duration,
+) error {
+	if finishedExpire < 0 {
+		// finished Trans data will expire in 1 days as default.
+		finishedExpire = time.Hour * 24
+	}
+
+	changed := *global
+	changed.Status = newStatus
+	doc, err := bson.Marshal(changed)
+	if err != nil {
+		return fmt.Errorf("[mongoTransStore.ChangeGlobalStatus] encode failed: %w", err)
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(doc, &fields); err != nil {
+		return fmt.Errorf("[mongoTransStore.ChangeGlobalStatus] encode failed: %w", err)
+	}
+	// only the fields named in updates, the steps and payloads MaySaveNew has left out stay out
+	set := bson.M{"status": newStatus}
+	for _, field := range updates {
+		set[field] = fields[field]
+	}
+	if finished && finishedExpire > 0 {
+		set["expire_at"] = time.Now().Add(finishedExpire)
+	}
+
+	ret, err := t.collection.UpdateOne(ctx, bson.M{"_id": global.Gid, "status": global.Status}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("[mongoTransStore.ChangeGlobalStatus] update failed: %w", err)
+	}
+	if ret.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	global.Status = newStatus
+	return nil
+}
+
+// SaveSignal the name must not contain "." or start with "$"
+func (t *mongoTransStore) SaveSignal(ctx context.Context, gid, name string, payload []byte) error {
+	if payload == nil {
+		payload = []byte{}
+	}
+	ret, err := t.collection.UpdateOne(ctx, bson.M{"_id": gid}, bson.M{"$set": bson.M{"signals." + name: payload}})
+	if err != nil {
+		return fmt.Errorf("[mongoTransStore.SaveSignal] update failed: %w", err)
+	}
+	if ret.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (t *mongoTransStore) FindSignal(ctx context.Context, gid, name string) ([]byte, bool, error) {
+	var trans mongoTrans
+	err := t.collection.FindOne(ctx, bson.M{"_id": gid}, options.FindOne().SetProjection(bson.M{"signals." + name: 1})).Decode(&trans)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("[mongoTransStore.FindSignal] find failed: %w", err)
+	}
+	payload, ok := trans.Signals[name]
+	return payload, ok, nil
+}
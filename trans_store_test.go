@@ -0,0 +1,169 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testTransStore the behaviour every TransStore shares, newStore returns an empty store
+func testTransStore(t *testing.T, newStore func(t *testing.T) TransStore) {
+	ctx := context.Background()
+	save := func(t *testing.T, store TransStore, gid string) *TransGlobal {
+		global, err := NewTransGlobal(&Message{Id: gid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		branches := []TransBranch{
+			{Index: 0, Gid: gid, BranchID: "01", TaskID: "charge", Op: OpCompensate, Status: StatusPrepared, CreateTime: &now},
+			{Index: 1, Gid: gid, BranchID: "01", TaskID: "charge", Op: OpAction, Status: StatusPrepared, CreateTime: &now},
+		}
+		if err := store.MaySaveNew(ctx, global, branches); err != nil {
+			t.Fatal(err)
+		}
+		return global
+	}
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store TransStore)
+	}{
+		{"save and find", func(t *testing.T, store TransStore) {
+			global := save(t, store, "order-1")
+
+			found, err := store.FindGlobal(ctx, "order-1")
+			if err != nil || found == nil || found.Gid != "order-1" || found.Status != StatusPrepared {
+				t.Fatalf("Expected the saved global, got: %+v %v", found, err)
+			}
+			if branches, err := store.FindBranches(ctx, "order-1"); err != nil || len(branches) != 2 || branches[1].Op != OpAction {
+				t.Errorf("Expected the saved branches, got: %+v %v", branches, err)
+			}
+			if err := store.MaySaveNew(ctx, global, nil); !errors.Is(err, ErrUniqueConflict) {
+				t.Errorf("Expected ErrUniqueConflict, got: %v", err)
+			}
+			if found, err := store.FindGlobal(ctx, "unknown"); err != nil || found != nil {
+				t.Errorf("Expected no global, got: %+v %v", found, err)
+			}
+		}},
+		{"change status", func(t *testing.T, store TransStore) {
+			global := save(t, store, "order-2")
+			stale := *global
+
+			if err := store.ChangeGlobalStatus(ctx, global, StatusAborting, []string{"status"}, false, -1); err != nil {
+				t.Fatal(err)
+			}
+			if found, _ := store.FindGlobal(ctx, "order-2"); found.Status != StatusAborting {
+				t.Errorf("Expected the global to be aborting, got: %s", found.Status)
+			}
+			if err := store.ChangeGlobalStatus(ctx, &stale, StatusSucceed, []string{"status"}, true, -1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected a stale status to be refused, got: %v", err)
+			}
+			if stale.Status != StatusPrepared {
+				t.Errorf("Expected a refused change to leave the global alone, got: %s", stale.Status)
+			}
+
+			// only the updated fields are written
+			global.Reason = "cancelled"
+			global.Owner = "support"
+			global.Steps = []map[string]string{{"action": "charge"}}
+			if err := store.ChangeGlobalStatus(ctx, global, StatusFailed, []string{"status", "reason"}, true, -1); err != nil {
+				t.Fatal(err)
+			}
+			found, _ := store.FindGlobal(ctx, "order-2")
+			if found.Status != StatusFailed || found.Reason != "cancelled" || found.Owner != "" || found.Steps != nil {
+				t.Errorf("Expected the status and the reason only, got: %+v", found)
+			}
+		}},
+		{"save branches", func(t *testing.T, store TransStore) {
+			save(t, store, "order-3")
+			branches, _ := store.FindBranches(ctx, "order-3")
+			branch := branches[1]
+			branch.Status = StatusSucceed
+
+			if err := store.LockGlobalSaveBranches(ctx, "order-3", StatusAborting, []TransBranch{branch}, 1); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected another status to be refused, got: %v", err)
+			}
+			if err := store.LockGlobalSaveBranches(ctx, "order-3", StatusPrepared, []TransBranch{branch}, 1); err != nil {
+				t.Fatal(err)
+			}
+			if branches, _ := store.FindBranches(ctx, "order-3"); branches[1].Status != StatusSucceed || branches[0].Status != StatusPrepared {
+				t.Errorf("Expected only the action to succeed, got: %+v", branches)
+			}
+		}},
+		{"signals", func(t *testing.T, store TransStore) {
+			save(t, store, "order-4")
+
+			if _, ok, err := store.FindSignal(ctx, "order-4", "paid"); err != nil || ok {
+				t.Errorf("Expected no signal yet, got: %v %v", ok, err)
+			}
+			if err := store.SaveSignal(ctx, "order-4", "paid", []byte("ch_1")); err != nil {
+				t.Fatal(err)
+			}
+			if payload, ok, err := store.FindSignal(ctx, "order-4", "paid"); err != nil || !ok || string(payload) != "ch_1" {
+				t.Errorf("Expected the signal payload, got: %q %v %v", payload, ok, err)
+			}
+			if err := store.SaveSignal(ctx, "unknown", "paid", nil); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got: %v", err)
+			}
+		}},
+		{"scan pages", func(t *testing.T, store TransStore) {
+			for i := 1; i <= 5; i++ {
+				save(t, store, fmt.Sprintf("scan-%d", i))
+			}
+
+			// the globals of a page leave the condition before the next page is read, e.g. recovered ones
+			seen := map[string]bool{}
+			position := ""
+			for page := 0; page < 5; page++ {
+				globals, err := store.ScanGlobals(ctx, &position, 2, TransGlobalScanCondition{Status: StatusPrepared})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range globals {
+					seen[globals[i].Gid] = true
+					if err := store.ChangeGlobalStatus(ctx, &globals[i], StatusSucceed, []string{"status"}, true, -1); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if position == "" {
+					break
+				}
+			}
+			if len(seen) != 5 || position != "" {
+				t.Errorf("Expected every global once and the last position empty, got: %v %q", seen, position)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newStore(t))
+		})
+	}
+}
+
+func TestMemoryTransStore(t *testing.T) {
+	testTransStore(t, func(t *testing.T) TransStore {
+		return NewMemoryTransStore()
+	})
+}
+
+func (s *BeanqSuite) TestMongoTransStore() {
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+	collection := connectWorkflowMongo(ctx, s.config.Mongo).Collection("trans_store_test")
+
+	testTransStore(s.T(), func(t *testing.T) TransStore {
+		if err := collection.Drop(s.ctx); err != nil {
+			t.Fatal(err)
+		}
+		store, err := NewMongoTransStore(s.ctx, collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/retail-ai-inc/beanq/v4/helper/bmongo"
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
 	"github.com/retail-ai-inc/beanq/v4/helper/timex"
+	public "github.com/retail-ai-inc/beanq/v4/internal"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
 	"github.com/retail-ai-inc/beanq/v4/internal/capture"
 	"github.com/retail-ai-inc/beanq/v4/internal/routers"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -115,7 +117,12 @@ func (c *Client) ServeHttp(ctx context.Context) {
 		workflowMongoCollection = client.Database(mongoCfg.Database).Collection(collection)
 	}
 
-	rlist := routers.RouterList(views, files, c.broker.client.(redis.UniversalClient), mog, workflowMongoCollection, c.broker.config.Redis.Prefix, c.broker.config.UI)
+	connections := make(map[string]redis.UniversalClient, len(c.broker.connections))
+	for name, driver := range c.broker.connections {
+		connections[name] = driver.client.(redis.UniversalClient)
+	}
+
+	rlist := routers.RouterList(views, files, c.broker.client.(redis.UniversalClient), connections, c.retryRoute(), mog, workflowMongoCollection, &workflowInspector{client: c}, c.broker.config.Redis.Prefix, c.broker.config.UI)
 	logger.New().Info("Beanq UI Start on port", httpport)
 
 	server := &http.Server{
@@ -171,3 +178,11 @@ func StaticFileInfo(fs2 fs.FS) (map[string]time.Time, error) {
 	}
 	return files, nil
 }
+
+// retryRoute the retries of the UI are published where and how the broker publishes them,
+// with the log settings and the priority lanes of the client
+func (c *Client) retryRoute() routers.Route {
+	return func(moodType btype.MoodType, channel, topic string) public.IBroker {
+		return c.broker.mood(moodType, channel, topic)
+	}
+}
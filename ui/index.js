@@ -84,6 +84,7 @@
           { path: 'log/dlq',component:()=>loadModule("./src/pages/log/dlq/dlq.vue",options)},
           { path: 'log/dlq/detail/:id',component:()=>loadModule("./src/pages/log/dlq/detail.vue",options)},
           { path: 'log/workflow',component:()=>loadModule("./src/pages/log/workflow/workflow.vue",options)},
+          { path: 'log/workflow/detail/:gid',component:()=>loadModule("./src/pages/log/workflow/detail.vue",options)},
           { path: 'log/sequence_lock',component:()=>loadModule("./src/pages/log/sequence_lock/list.vue",options)},
           { path: 'redis', component: () => loadModule("./src/pages/redis/info.vue", options) },
           { path: 'redis/monitor',component:()=>loadModule("./src/pages/redis/monitor.vue",options)},
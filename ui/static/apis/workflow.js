@@ -6,4 +6,14 @@ const workflowApi = {
         let params = {id: id};
         return request.post(`/workflow/delete`, params);
     },
+    Timeline(gid) {
+        return request.get(`/workflow/trans/${encodeURIComponent(gid)}/timeline`);
+    },
+    Compensate(gid, reason) {
+        let params = {reason: reason};
+        return request.post(`/workflow/trans/${encodeURIComponent(gid)}/compensate`, params);
+    },
+    SucceedBranch(gid, index) {
+        return request.post(`/workflow/trans/${encodeURIComponent(gid)}/branch/${index}/succeed`);
+    },
 }
\ No newline at end of file
@@ -10,9 +10,14 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	errorstack "github.com/pkg/errors"
+	"github.com/retail-ai-inc/beanq/v4/helper/bstatus"
+	"github.com/retail-ai-inc/beanq/v4/helper/json"
 	"github.com/retail-ai-inc/beanq/v4/helper/logger"
+	"github.com/retail-ai-inc/beanq/v4/helper/timex"
 	"github.com/retail-ai-inc/beanq/v4/helper/tool"
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
 	"github.com/retail-ai-inc/beanq/v4/internal/driver/bredis"
+	"github.com/rs/xid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -21,6 +26,10 @@ import (
 const (
 	OpAction     = "action"
 	OpCompensate = "compensate"
+
+	// childDedupWindow how long a child workflow message is not published twice,
+	// after that the trans global of the consumed child stops it
+	childDedupWindow = 24 * time.Hour
 )
 
 // ErrWorkflowFailure error of FAILURE
@@ -29,6 +38,18 @@ var ErrWorkflowFailure = errors.New("WORKFLOW FAILURE")
 // ErrWorfflowOngoing error of ONGOING
 var ErrWorkflowOngoing = errors.New("WORKFLOW ONGOING")
 
+// ErrTaskTimeout error of a task attempt exceeding its Timeout
+var ErrTaskTimeout = errors.New("TASK TIMEOUT")
+
+// ErrSignalTimeout error of a task which has not received its signal in time
+var ErrSignalTimeout = errors.New("SIGNAL TIMEOUT")
+
+// ErrNoTaskState the action of the task has not saved a state by SetState
+var ErrNoTaskState = errors.New("NO TASK STATE")
+
+// ErrWorkflowVersion the saga was started by another version of the workflow definition
+var ErrWorkflowVersion = errors.New("WORKFLOW VERSION MISMATCH")
+
 type (
 	Workflow struct {
 		gid              string
@@ -43,6 +64,10 @@ type (
 		transaction      *TransGlobal
 		progresses       []TransBranch
 		skipper          func(error) bool
+		// broker publishes child workflows and resumes the parent, it's set when consumed by a Client
+		broker *Broker
+		// mu guards transaction while independent branches run concurrently
+		mu sync.Mutex
 	}
 
 	WFMux interface {
@@ -59,11 +84,17 @@ type (
 		Retry   int    `json:"retry"`
 		Async   bool   `json:"async"`
 		Storage string `json:"storage"`
+		// TransStore where the saga progress is kept: redis(default), mongo or memory
+		TransStore string `json:"transStore"`
+		// TransExpire how long the redis trans store keeps an unfinished saga, 7 days by default
+		TransExpire time.Duration `json:"transExpire"`
 	}
 )
 
 var (
 	workflowClient      redis.UniversalClient
+	workflowMux         *MuxClient
+	workflowTransStore  TransStore
 	workflowRedisConfig *Redis
 	workflowOnce        sync.Once
 	workflowConfig      = &struct {
@@ -80,61 +111,93 @@ var (
 // InitWorkflow make workflow as an independent module
 func InitWorkflow(beanqConfig *BeanqConfig) {
 	workflowOnce.Do(func() {
-		workflowClient = bredis.NewRdb(
-			beanqConfig.Redis.Host,
-			beanqConfig.Redis.Port,
-			beanqConfig.Redis.Password,
-			beanqConfig.Redis.Database,
-			beanqConfig.Redis.MaxRetries,
-			beanqConfig.Redis.DialTimeout,
-			beanqConfig.Redis.ReadTimeout,
-			beanqConfig.Redis.WriteTimeout,
-			beanqConfig.Redis.PoolTimeout,
-			beanqConfig.Redis.PoolSize,
-			beanqConfig.Redis.MinIdleConnections)
-
 		workflowRedisConfig = &beanqConfig.Redis
 		workflowConfig.Collection = struct {
 			Name  string
 			Shard bool
 		}{Name: "workflow_records", Shard: true}
 		//nolint:staticcheck,qf1008 //enhance readability
-		if v, ok := beanqConfig.Mongo.Collections["workflow"]; ok {
-			workflowConfig.Collection.Name = v.Name
-			workflowConfig.Collection.Shard = v.Shard
+		if beanqConfig.Mongo != nil {
+			if v, ok := beanqConfig.Mongo.Collections["workflow"]; ok {
+				workflowConfig.Collection.Name = v.Name
+				workflowConfig.Collection.Shard = v.Shard
+			}
 		}
 		workflowConfig.WorkFlow = &beanqConfig.WorkFlow
 		workflowConfig.History = &beanqConfig.History
 		workflowConfig.Mongo = beanqConfig.Mongo
+
+		switch beanqConfig.WorkFlow.TransStore {
+		case "mongo":
+			if beanqConfig.Mongo == nil {
+				panic("workflow trans store: mongo is not configured")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			// the sagas live next to the workflow records
+			collection := connectWorkflowMongo(ctx, beanqConfig.Mongo).Collection(workflowConfig.Collection.Name + "_trans")
+			store, err := NewMongoTransStore(ctx, collection)
+			if err != nil {
+				panic(err)
+			}
+			workflowTransStore = store
+		case "memory":
+			workflowTransStore = NewMemoryTransStore()
+		default:
+			options, err := beanqConfig.Redis.options()
+			if err != nil {
+				logger.New().Fatal(err.Error())
+			}
+			workflowClient = bredis.NewRdb(
+				beanqConfig.Redis.Host,
+				beanqConfig.Redis.Port,
+				beanqConfig.Redis.Password,
+				beanqConfig.Redis.Database,
+				beanqConfig.Redis.MaxRetries,
+				beanqConfig.Redis.DialTimeout,
+				beanqConfig.Redis.ReadTimeout,
+				beanqConfig.Redis.WriteTimeout,
+				beanqConfig.Redis.PoolTimeout,
+				beanqConfig.Redis.PoolSize,
+				beanqConfig.Redis.MinIdleConnections,
+				options)
+
+			expire := beanqConfig.WorkFlow.TransExpire
+			if expire <= 0 {
+				expire = 7 * 24 * time.Hour
+			}
+			workflowTransStore = NewTransStore(workflowClient, workflowRedisConfig.Prefix+":"+"workflow", expire)
+			workflowMux = NewMuxClient(workflowClient).SetPrefix(workflowRedisConfig.Prefix + ":workflow:lock")
+		}
 	})
 }
 
 func NewWorkflow(ctx context.Context, message *Message) (*Workflow, error) {
-	if workflowClient == nil {
+	if workflowTransStore == nil {
 		panic("workflow client not initialized")
 	}
 
-	// prepare workflow, get process from redis by gid
-	ts := NewTransStore(
-		workflowClient,
-		workflowRedisConfig.Prefix+":"+"workflow",
-		7*24*time.Hour)
-
 	transGlobal, err := NewTransGlobal(message)
 	if err != nil {
 		return nil, errorstack.WithStack(err)
 	}
 
-	return &Workflow{
+	w := &Workflow{
 		ctx:         ctx,
-		gid:         message.Id,
+		gid:         message.workflowGid(),
 		message:     message,
 		tasks:       make([]*task, 0),
 		record:      NewWorkflowRecord(),
-		transStore:  ts,
+		transStore:  workflowTransStore,
 		transaction: transGlobal,
 		progresses:  []TransBranch{},
-	}, nil
+	}
+	// a redelivered message and the recovery scanner never run the same workflow at once,
+	// WfOptionMux replaces the lock
+	if workflowMux != nil {
+		w.wfMux = workflowMux.NewMutex(w.gid)
+	}
+	return w, nil
 }
 
 func (w *Workflow) Init(opts ...func(workflow *Workflow)) {
@@ -157,6 +220,29 @@ func WfOptionMux(mux WFMux) func(workflow *Workflow) {
 	}
 }
 
+// WfOptionType name the workflow, the recovery scanner rebuilds it with the handler registered by RegisterWorkflow
+func WfOptionType(workflowType string) func(workflow *Workflow) {
+	return func(workflow *Workflow) {
+		workflow.transaction.TransType = workflowType
+	}
+}
+
+// WfOptionVersion the version of the task definition, it's saved when the saga starts
+// and a resumed saga only runs with the same version, see RegisterWorkflowVersion
+func WfOptionVersion(version int) func(workflow *Workflow) {
+	return func(workflow *Workflow) {
+		workflow.transaction.Version = version
+	}
+}
+
+// WfOptionTransStore keep the progress of this workflow in another store than the one of InitWorkflow,
+// send its signals with Client.SignalWorkflowIn.
+func WfOptionTransStore(store TransStore) func(workflow *Workflow) {
+	return func(workflow *Workflow) {
+		workflow.transStore = store
+	}
+}
+
 func WfSkipper(skipper func(error) bool) func(workflow *Workflow) {
 	return func(worflow *Workflow) {
 		worflow.skipper = skipper
@@ -212,6 +298,11 @@ func (w *Workflow) Run() (err error) {
 	index := -1
 	now := time.Now()
 
+	dependencies, err := w.tasks.dependencies()
+	if err != nil {
+		return errorstack.WithStack(err)
+	}
+
 	for i, task := range w.tasks {
 		branchID := fmt.Sprintf("%02d", i+1)
 
@@ -231,10 +322,33 @@ func (w *Workflow) Run() (err error) {
 				Error:        "",
 				CreateTime:   &now,
 				UpdateTime:   &now,
+				DependsOn:    dependencies[i],
 			})
 		}
 	}
 
+	// the saga is loaded under the lock, a run which has waited for it sees what the holder has left
+	if w.wfMux != nil {
+		var lerr error
+		// long tasks must not outlive the lock, the watchdog keeps extending it
+		if wd, ok := w.wfMux.(interface {
+			LockWithWatchdog(ctx context.Context) (int64, error)
+		}); ok {
+			_, lerr = wd.LockWithWatchdog(w.ctx)
+		} else {
+			lerr = w.wfMux.LockContext(w.ctx)
+		}
+		if lerr != nil {
+			return errorstack.WithStack(lerr)
+		}
+		defer func() {
+			if _, err := w.wfMux.UnlockContext(w.ctx); err != nil {
+				logger.New().Error(err)
+			}
+		}()
+	}
+
+	version := w.transaction.Version
 	err = w.transStore.MaySaveNew(w.ctx, w.transaction, progresses)
 
 	if errors.Is(err, ErrUniqueConflict) {
@@ -243,6 +357,10 @@ func (w *Workflow) Run() (err error) {
 		if err != nil {
 			return errorstack.WithStack(err)
 		}
+		// the saved branches belong to the tasks of another definition, leave them untouched
+		if w.transaction.Version != version {
+			return errorstack.Wrap(ErrWorkflowVersion, fmt.Sprintf("started with version %d, running version %d", w.transaction.Version, version))
+		}
 
 		w.progresses, err = w.transStore.FindBranches(w.ctx, w.gid)
 		if err != nil {
@@ -261,17 +379,6 @@ func (w *Workflow) Run() (err error) {
 	default:
 	}
 
-	if w.wfMux != nil {
-		if err := w.wfMux.LockContext(w.ctx); err != nil {
-			return errorstack.WithStack(err)
-		}
-		defer func() {
-			if _, err := w.wfMux.UnlockContext(w.ctx); err != nil {
-				logger.New().Error(err)
-			}
-		}()
-	}
-
 	actions, compensates := w.initSteps()
 
 ACTION:
@@ -288,22 +395,27 @@ ACTION:
 			break ACTION
 		}
 
-		for _, branch := range ac {
-			err = w.executor(branch, OpAction)
-			if err != nil {
-				break ACTION
-			}
+		err = w.executeAll(ac, OpAction)
+		if err != nil {
+			break ACTION
 		}
 	}
 
-	if err == nil {
+	// a resumed workflow may already be aborting
+	if err == nil && w.transaction.Status == StatusPrepared {
 		err2 := w.ChangeStatus(w.ctx, StatusSucceed)
 		if err2 != nil {
 			return err2
 		}
+		w.resumeParent()
 		return nil
 	}
 
+	if w.transaction.Status == StatusPrepared && errors.Is(err, ErrWorkflowOngoing) {
+		// parked until a signal resumes it
+		return err
+	}
+
 COMPENSATE:
 	for w.transaction.Status == StatusAborting {
 		select {
@@ -318,11 +430,9 @@ COMPENSATE:
 			break COMPENSATE
 		}
 
-		for _, branch := range ac {
-			err = w.executor(branch, OpCompensate)
-			if err != nil {
-				break COMPENSATE
-			}
+		err = w.executeAll(ac, OpCompensate)
+		if err != nil {
+			break COMPENSATE
 		}
 	}
 
@@ -331,12 +441,33 @@ COMPENSATE:
 		if err2 != nil {
 			return err2
 		}
+		w.resumeParent()
 		return nil
 	}
 
 	return nil
 }
 
+// executeAll run independent branches concurrently and wait for all of them
+func (w *Workflow) executeAll(branches []*TransBranch, op string) error {
+	if len(branches) == 1 {
+		return w.executor(branches[0], op)
+	}
+
+	errs := make([]error, len(branches))
+	var wg sync.WaitGroup
+	for i, branch := range branches {
+		wg.Add(1)
+		go func(i int, branch *TransBranch) {
+			defer wg.Done()
+			errs[i] = w.executor(branch, op)
+		}(i, branch)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
 func (w *Workflow) executor(branch *TransBranch, op string) (err error) {
 	defer func() {
 		if e := recover(); e != nil || err != nil {
@@ -348,7 +479,7 @@ func (w *Workflow) executor(branch *TransBranch, op string) (err error) {
 	}()
 
 	err = w.tasks.Run(w.ctx, branch, op)
-	if err != nil {
+	if err != nil && !errors.Is(err, ErrWorkflowOngoing) {
 		err2 := w.ChangeStatus(w.ctx, StatusAborting, err.Error())
 		if err2 != nil {
 			err = errorstack.Wrap(err, err2.Error())
@@ -362,7 +493,53 @@ func (w *Workflow) executor(branch *TransBranch, op string) (err error) {
 	return err
 }
 
+// resumeParent publish the message of the parent workflow again once this child has finished
+func (w *Workflow) resumeParent() {
+	if w.message.ParentGid == "" || w.broker == nil {
+		return
+	}
+	if err := resumeWorkflow(w.ctx, w.transStore, w.broker, w.message.ParentGid); err != nil {
+		logger.New().Error(err)
+	}
+}
+
+// resumeWorkflow publish the message of an unfinished workflow again, so Run continues where it stopped
+func resumeWorkflow(ctx context.Context, store TransStore, broker *Broker, gid string) error {
+	global, err := store.FindGlobal(ctx, gid)
+	if err != nil {
+		return err
+	}
+	if global == nil {
+		return fmt.Errorf("workflow %s: %w", gid, ErrNotFound)
+	}
+	if global.Status != StatusPrepared && global.Status != StatusAborting {
+		return fmt.Errorf("workflow %s is %s, it can't be resumed", gid, global.Status)
+	}
+	if global.MessageData == "" {
+		return fmt.Errorf("workflow %s has no message to resume it", gid)
+	}
+
+	var message Message
+	if err := json.Unmarshal([]byte(global.MessageData), &message); err != nil {
+		return err
+	}
+	now := time.Now()
+	message.Id = xid.NewWithTime(now).String()
+	message.WorkflowGid = gid
+	message.AddTime = now.Format(timex.DateTime)
+	message.ExecuteTime = now
+	// the resumed message must not be merged or continue a chain twice
+	message.DedupKey = ""
+	message.CollapseKey = ""
+	message.Chain = ""
+
+	return broker.Enqueue(ctx, message.ToMap())
+}
+
 func (w *Workflow) ChangeStatus(ctx context.Context, status string, reason ...string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	updates := []string{"status", "update_time"}
 	now := time.Now()
 	switch status {
@@ -388,6 +565,13 @@ func (w *Workflow) ChangeStatus(ctx context.Context, status string, reason ...st
 	return nil
 }
 
+func (w *Workflow) status() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.transaction.Status
+}
+
 func (w *Workflow) initSteps() (actions, compensates func() []*TransBranch) {
 	n := len(w.progresses)
 	branchResults := make([]*TransBranch, n)
@@ -395,14 +579,41 @@ func (w *Workflow) initSteps() (actions, compensates func() []*TransBranch) {
 		branchResults[i] = &w.progresses[i]
 	}
 
+	// actions are at odd indexes, dependencies and dependents are kept by action index
+	actionIndex := make(map[string]int, n/2)
+	for i := 1; i < n; i += 2 {
+		actionIndex[branchResults[i].TaskID] = i
+	}
+	dependencies := make(map[int][]int, n/2)
+	dependents := make(map[int][]int, n/2)
+	for i := 1; i < n; i += 2 {
+		if branchResults[i].DependsOn == nil {
+			// branches saved without dependencies run one after another
+			if i >= 3 {
+				dependencies[i] = []int{i - 2}
+			}
+		} else {
+			for _, id := range branchResults[i].DependsOn {
+				if j, ok := actionIndex[id]; ok {
+					dependencies[i] = append(dependencies[i], j)
+				}
+			}
+		}
+		for _, j := range dependencies[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
 	shouldRun := func(current int) bool {
 		if branchResults[current].Status != StatusPrepared {
 			return false
 		}
 
-		// check the branch in previous step is succeed
-		if current >= 2 && branchResults[current-2].Status != StatusSucceed {
-			return false
+		// check the actions it depends on are succeed
+		for _, dep := range dependencies[current] {
+			if branchResults[dep].Status != StatusSucceed {
+				return false
+			}
 		}
 
 		return true
@@ -423,9 +634,11 @@ func (w *Workflow) initSteps() (actions, compensates func() []*TransBranch) {
 			return false
 		}
 
-		// check the branch in next step is rollbacked
-		if current < n-2 && !rollbacked(current+2) {
-			return false
+		// check the branches depending on it are rollbacked
+		for _, dep := range dependents[current+1] {
+			if !rollbacked(dep - 1) {
+				return false
+			}
 		}
 
 		return true
@@ -464,8 +677,92 @@ type Task interface {
 	UpdateStatus(ctx context.Context, branch *TransBranch, oerr error) error
 }
 
+// TaskContext is implemented by the Task given to OnExecute and OnRollback, assert it to get the context of the attempt:
+//
+//	ctx := task.(beanq.TaskContext).Context()
+type TaskContext interface {
+	// Context is canceled when the attempt exceeds the task Timeout
+	Context() context.Context
+}
+
+// TaskSignal is implemented by the Task given to OnExecute, assert it to get the payload of the signal:
+//
+//	payload := task.(beanq.TaskSignal).SignalPayload()
+type TaskSignal interface {
+	// SignalPayload the payload of the signal given to WaitForSignal
+	SignalPayload() []byte
+}
+
+// TaskState is implemented by the Task given to OnExecute and OnRollback, assert it to pass a state
+// from the action to the rollback:
+//
+//	err := task.(beanq.TaskState).SetState(id)
+type TaskState interface {
+	SetState(v any) error
+	State(v any) error
+}
+
 type tasks []*task
 
+// dependencies resolve the task ids each task depends on,
+// a task without DependsOn depends on the previous one.
+func (t tasks) dependencies() ([][]string, error) {
+	index := make(map[string]int, len(t))
+	for i, tk := range t {
+		if _, ok := index[tk.id]; ok {
+			return nil, fmt.Errorf("duplicate task id: %s", tk.id)
+		}
+		index[tk.id] = i
+	}
+
+	dependencies := make([][]string, len(t))
+	indegree := make([]int, len(t))
+	dependents := make([][]int, len(t))
+	for i, tk := range t {
+		deps := tk.dependsOn
+		if deps == nil {
+			deps = []string{}
+			if i > 0 {
+				deps = []string{t[i-1].id}
+			}
+		}
+		for _, id := range deps {
+			j, ok := index[id]
+			if !ok {
+				return nil, fmt.Errorf("task %s depends on unknown task %s", tk.id, id)
+			}
+			indegree[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+		dependencies[i] = deps
+	}
+
+	// Kahn's algorithm, every task must be reachable from the roots
+	queue := make([]int, 0, len(t))
+	for i := range t {
+		if indegree[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited++
+		for _, j := range dependents[i] {
+			indegree[j]--
+			if indegree[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if visited != len(t) {
+		return nil, errors.New("task dependencies contain a cycle")
+	}
+
+	return dependencies, nil
+}
+
 func (t tasks) Run(ctx context.Context, branch *TransBranch, op string) error {
 	var err error
 	var tk *task
@@ -481,11 +778,25 @@ func (t tasks) Run(ctx context.Context, branch *TransBranch, op string) error {
 		return errorstack.New("no task to run")
 	}
 
+	if branch.StartTime == nil {
+		now := time.Now()
+		branch.StartTime = &now
+	}
+
 	switch op {
 	case OpAction:
-		err = tk.Execute()
+		err = tk.wait(ctx, branch)
+		if err == nil {
+			err = tk.runChild(ctx, branch)
+		}
+		if err == nil {
+			err = tk.Execute()
+		}
 	case OpCompensate:
-		err = tk.Rollback()
+		err = tk.rollbackChild(ctx)
+		if err == nil {
+			err = tk.Rollback()
+		}
 	default:
 		err = errorstack.New("unspport task option")
 	}
@@ -506,27 +817,84 @@ type task struct {
 	rollbackFunc func(task Task) error
 	statement    []byte
 	skipper      func(error) bool
+	dependsOn    []string
+	timeout      time.Duration
+	retryPolicy  *RetryPolicy
+
+	signal        string
+	signalTimeout time.Duration
+	signalPayload []byte
+
+	child *childWorkflow
+
+	// state saved by the action for the rollback, the attempts may outlive their timeout
+	state   []byte
+	stateMu sync.Mutex
+}
+
+type childWorkflow struct {
+	channel string
+	topic   string
+	payload []byte
+}
+
+// attemptTask the task seen by one attempt, it carries the context of the attempt
+type attemptTask struct {
+	*task
+	ctx context.Context
+}
+
+func (t *attemptTask) Context() context.Context {
+	return t.ctx
+}
+
+// RetryPolicy how a failed task attempt is retried
+type RetryPolicy struct {
+	// Retryable reports whether the error is worth another attempt, nil retries every error
+	Retryable func(error) bool
+	// Retries the number of attempts after the first one
+	Retries int
+	// MinBackoff and MaxBackoff bound the jittered exponential wait between attempts
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func (p *RetryPolicy) retry(attempt int, err error) bool {
+	if p == nil || attempt >= p.Retries {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = 500 * time.Millisecond
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	return tool.JitterBackoff(minBackoff, maxBackoff, attempt)
 }
 
 func (t *task) ID() string {
 	return t.id
 }
 
+func (t *task) Context() context.Context {
+	return t.wf.ctx
+}
+
 func (t *task) Execute() error {
 	if t.executeFunc == nil {
+		if t.signal != "" || t.child != nil {
+			// a task which only waits for its signal or child workflow
+			return nil
+		}
 		return errors.New("executeFunc is nil")
 	}
 
-	// business side handle the retry
-	err := t.executeFunc(t)
-
-	t.trackRecord(t.id, &TaskStatus{
-		option:    OpAction,
-		statement: t.Statement(),
-		err:       err,
-	})
-
-	return err
+	return t.attempts(OpAction, t.executeFunc)
 }
 
 func (t *task) Skipper(skipper func(error) bool) *task {
@@ -538,17 +906,291 @@ func (t *task) Rollback() error {
 	if t.rollbackFunc == nil {
 		return nil
 	}
-	err := t.rollbackFunc(t)
 
-	t.trackRecord(t.id, &TaskStatus{
-		option:    OpCompensate,
-		statement: t.Statement(),
-		err:       err,
-	})
+	return t.attempts(OpCompensate, t.rollbackFunc)
+}
+
+// attempts call fn until it succeeds or the retry policy gives up, every attempt is recorded
+func (t *task) attempts(option string, fn func(task Task) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(t.retryPolicy.backoff(attempt - 1)):
+			case <-t.wf.ctx.Done():
+				return errors.Join(err, t.wf.ctx.Err())
+			}
+		}
+
+		err = t.attempt(fn)
+
+		t.trackRecord(t.id, &TaskStatus{
+			option:    option,
+			statement: t.Statement(),
+			err:       err,
+			attempt:   attempt + 1,
+		})
+
+		if err == nil || t.skipper(err) || errors.Is(err, ErrWorkflowOngoing) || !t.retryPolicy.retry(attempt, err) {
+			return err
+		}
+	}
+}
+
+func (t *task) attempt(fn func(task Task) error) error {
+	if t.timeout <= 0 {
+		return fn(&attemptTask{task: t, ctx: t.wf.ctx})
+	}
+
+	ctx, cancel := context.WithTimeout(t.wf.ctx, t.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("[panic recover]: %+v\n%s", p, debug.Stack())
+			}
+		}()
+		done <- fn(&attemptTask{task: t, ctx: ctx})
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		// the next attempt must not overlap this one, an action ignoring the context delays it until it returns
+		<-done
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %s exceeded %s", ErrTaskTimeout, t.id, t.timeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// WaitForSignal the task executes once Client.SignalWorkflow sends `name`, until then the workflow is parked.
+// When the signal has not arrived within `timeout` since the task was reached, the task fails with ErrSignalTimeout
+// and the workflow is compensated. The timeout is checked whenever the workflow runs again,
+// run a WorkflowRecovery to resume the workflows which never get their signal. A timeout <= 0 waits forever.
+func (t *task) WaitForSignal(name string, timeout time.Duration) *task {
+	t.signal = name
+	t.signalTimeout = timeout
+	return t
+}
+
+func (t *task) SignalPayload() []byte {
+	return t.signalPayload
+}
+
+// SetState keep `v` for the rollback of this task, e.g. the id of what the action created.
+// It's saved as json with the action branch, so the rollback gets it after a crash as well.
+func (t *task) SetState(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	t.state = b
+	return nil
+}
+
+// State decode the state saved by SetState into `v`, ErrNoTaskState when the action has not saved one
+func (t *task) State(v any) error {
+	t.stateMu.Lock()
+	state := t.state
+	t.stateMu.Unlock()
+
+	if len(state) == 0 {
+		// saved by a previous run
+		for _, branch := range t.wf.progresses {
+			if branch.TaskID == t.id && branch.Op == OpAction {
+				state = branch.BinData
+				break
+			}
+		}
+	}
+	if len(state) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoTaskState, t.id)
+	}
+	return json.Unmarshal(state, v)
+}
+
+// wait returns ErrWorkflowOngoing until the signal of the task has been sent
+func (t *task) wait(ctx context.Context, branch *TransBranch) error {
+	if t.signal == "" {
+		return nil
+	}
+
+	payload, ok, err := t.wf.transStore.FindSignal(ctx, t.wf.gid, t.signal)
+	if err != nil {
+		return err
+	}
+	if ok {
+		t.signalPayload = payload
+		return nil
+	}
+
+	now := time.Now()
+	if branch.WaitUntil == nil {
+		until := now.Add(t.signalTimeout)
+		branch.WaitUntil = &until
+		branch.UpdateTime = &now
+		if err := t.wf.transStore.LockGlobalSaveBranches(ctx, t.wf.transaction.Gid, t.wf.status(), []TransBranch{*branch}, branch.Index); err != nil {
+			return errorstack.WithStack(err)
+		}
+	}
+	if t.signalTimeout > 0 && now.After(*branch.WaitUntil) {
+		return fmt.Errorf("%w: %s", ErrSignalTimeout, t.signal)
+	}
+
+	return fmt.Errorf("%w: waiting for signal %s", ErrWorkflowOngoing, t.signal)
+}
+
+// ChildWorkflow publish a workflow message to channel/topic when the task is reached and wait for that workflow to finish,
+// the task fails when the child fails. Compensating the task compensates a succeeded child first.
+// The child is consumed like any workflow, it must share the trans store with the parent.
+func (t *task) ChildWorkflow(channel, topic string, payload []byte) *task {
+	t.child = &childWorkflow{channel: channel, topic: topic, payload: payload}
+	return t
+}
+
+// childGid is stable, so a resumed parent finds the same child
+func (t *task) childGid() string {
+	return t.wf.gid + "-" + t.id
+}
 
+func (t *task) runChild(ctx context.Context, branch *TransBranch) error {
+	if t.child == nil {
+		return nil
+	}
+
+	gid := t.childGid()
+	child, err := t.wf.transStore.FindGlobal(ctx, gid)
+	if err != nil {
+		return err
+	}
+
+	if child == nil {
+		if branch.ChildGid == "" {
+			if err := t.publishChild(ctx, gid); err != nil {
+				return err
+			}
+			now := time.Now()
+			branch.ChildGid = gid
+			branch.UpdateTime = &now
+			if err := t.wf.transStore.LockGlobalSaveBranches(ctx, t.wf.transaction.Gid, t.wf.status(), []TransBranch{*branch}, branch.Index); err != nil {
+				return errorstack.WithStack(err)
+			}
+		}
+		return fmt.Errorf("%w: waiting for child workflow %s", ErrWorkflowOngoing, gid)
+	}
+
+	switch child.Status {
+	case StatusSucceed:
+		return nil
+	case StatusFailed:
+		return fmt.Errorf("child workflow %s: %w: %s", gid, ErrWorkflowFailure, child.Reason)
+	default:
+		return fmt.Errorf("%w: waiting for child workflow %s", ErrWorkflowOngoing, gid)
+	}
+}
+
+func (t *task) publishChild(ctx context.Context, gid string) error {
+	if t.wf.broker == nil {
+		return errors.New("child workflows need the workflow to be consumed by a beanq client")
+	}
+
+	message := t.childMessage(gid, time.Now())
+	err := t.wf.broker.Enqueue(ctx, message.ToMap())
+	if errors.Is(err, bstatus.ErrIdempotent) {
+		// published by a previous run
+		return nil
+	}
 	return err
 }
 
+// childMessage the message of the child workflow, publishing it again is refused whatever its mood:
+// the sequence moods refuse the same id, the others are deduplicated by the gid.
+func (t *task) childMessage(gid string, now time.Time) Message {
+	parent := t.wf.message
+	message := Message{
+		Id:          gid,
+		Channel:     t.child.channel,
+		Topic:       t.child.topic,
+		Payload:     string(t.child.payload),
+		MoodType:    parent.MoodType,
+		AddTime:     now.Format(timex.DateTime),
+		ExecuteTime: now,
+		MaxLen:      parent.MaxLen,
+		Retry:       parent.Retry,
+		TimeToRun:   parent.TimeToRun,
+		ParentGid:   t.wf.gid,
+	}
+	if message.MoodType != btype.SEQUENCE && message.MoodType != btype.SEQUENCE_BY_LOCK {
+		message.DedupKey = gid
+		message.DedupWindow = childDedupWindow
+	}
+	return message
+}
+
+// rollbackChild compensate a succeeded child before the task itself
+func (t *task) rollbackChild(ctx context.Context) error {
+	if t.child == nil {
+		return nil
+	}
+
+	gid := t.childGid()
+	child, err := t.wf.transStore.FindGlobal(ctx, gid)
+	if err != nil {
+		return err
+	}
+	if child == nil {
+		// never started or expired
+		return nil
+	}
+
+	switch child.Status {
+	case StatusFailed:
+		return nil
+	case StatusSucceed:
+		if t.wf.broker == nil {
+			return errors.New("child workflows need the workflow to be consumed by a beanq client")
+		}
+		now := time.Now()
+		child.UpdateTime = &now
+		child.Reason = "compensated by parent workflow " + t.wf.gid
+		if err := t.wf.transStore.ChangeGlobalStatus(ctx, child, StatusAborting, []string{"status", "update_time", "reason"}, false, -1); err != nil {
+			return err
+		}
+		if err := resumeWorkflow(ctx, t.wf.transStore, t.wf.broker, gid); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: waiting for child workflow %s to compensate", ErrWorkflowOngoing, gid)
+}
+
+// Timeout limit every attempt of execute and rollback, the callback should return once Task.Context is done
+func (t *task) Timeout(d time.Duration) *task {
+	t.timeout = d
+	return t
+}
+
+// Retry execute and rollback again on failure according to the policy
+func (t *task) Retry(policy RetryPolicy) *task {
+	t.retryPolicy = &policy
+	return t
+}
+
+// DependsOn the task runs after the actions of the given tasks succeed,
+// tasks whose dependencies are met run concurrently. Without args the task has no dependency.
+// A task which never calls DependsOn depends on the task created before it.
+func (t *task) DependsOn(ids ...string) *task {
+	t.dependsOn = append([]string{}, ids...)
+	return t
+}
+
 func (t *task) OnExecute(fn func(task Task) error) *task {
 	t.executeFunc = fn
 	return t
@@ -588,6 +1230,7 @@ func (t *task) trackRecord(taskID string, status *TaskStatus) {
 		Status    string             `bson:"Status"`
 		Statement string             `bson:"Statement"`
 		Error     string             `bson:"Error"`
+		Attempt   int                `bson:"Attempt"`
 		Skipper   bool               `bson:"Skipper"`
 		Id        primitive.ObjectID `bson:"_id"`
 	}{
@@ -602,6 +1245,7 @@ func (t *task) trackRecord(taskID string, status *TaskStatus) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Error:     status.Error(),
+		Attempt:   status.attempt,
 		Skipper:   skipper,
 	}
 
@@ -628,12 +1272,20 @@ func (t *task) UpdateStatus(ctx context.Context, branch *TransBranch, oerr error
 	}
 
 	if status != "" {
+		if branch.Op == OpAction {
+			t.stateMu.Lock()
+			if len(t.state) > 0 {
+				branch.BinData = t.state
+			}
+			t.stateMu.Unlock()
+		}
+
 		now := time.Now()
 		branch.FinishTime = &now
 		branch.UpdateTime = &now
 		branch.Status = status
 
-		err := t.wf.transStore.LockGlobalSaveBranches(ctx, t.wf.transaction.Gid, t.wf.transaction.Status, []TransBranch{*branch}, branch.Index)
+		err := t.wf.transStore.LockGlobalSaveBranches(ctx, t.wf.transaction.Gid, t.wf.status(), []TransBranch{*branch}, branch.Index)
 		if err != nil {
 			return errorstack.WithStack(err)
 		}
@@ -679,37 +1331,41 @@ func NewWorkflowRecord() *WorkflowRecord {
 		if workflowCfg.On && mongoCfg != nil && mongoCfg.Database != "" {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			connURI := "mongodb://" + mongoCfg.Host + ":" + mongoCfg.Port
-			opts := options.Client().
-				ApplyURI(connURI).
-				SetConnectTimeout(mongoCfg.ConnectTimeOut).
-				SetMaxPoolSize(mongoCfg.MaxConnectionPoolSize).
-				SetMaxConnIdleTime(mongoCfg.MaxConnectionLifeTime)
-
-			if mongoCfg.UserName != "" && mongoCfg.Password != "" {
-				opts.SetAuth(options.Credential{
-					AuthSource: mongoCfg.Database,
-					Username:   mongoCfg.UserName,
-					Password:   mongoCfg.Password,
-				})
-			}
-
-			mdb, err := mongo.Connect(ctx, opts)
-			if err != nil {
-				panic(err)
-			}
-
-			// check connect
-			err = mdb.Ping(ctx, nil)
-			if err != nil {
-				panic(err)
-			}
-			workflowRecord.mongoCollection = mdb.Database(mongoCfg.Database).Collection(collection.Name)
+			workflowRecord.mongoCollection = connectWorkflowMongo(ctx, mongoCfg).Collection(collection.Name)
 		}
 	})
 	return workflowRecord
 }
 
+func connectWorkflowMongo(ctx context.Context, mongoCfg *Mongo) *mongo.Database {
+	connURI := "mongodb://" + mongoCfg.Host + ":" + mongoCfg.Port
+	opts := options.Client().
+		ApplyURI(connURI).
+		SetConnectTimeout(mongoCfg.ConnectTimeOut).
+		SetMaxPoolSize(mongoCfg.MaxConnectionPoolSize).
+		SetMaxConnIdleTime(mongoCfg.MaxConnectionLifeTime)
+
+	if mongoCfg.UserName != "" && mongoCfg.Password != "" {
+		opts.SetAuth(options.Credential{
+			AuthSource: mongoCfg.Database,
+			Username:   mongoCfg.UserName,
+			Password:   mongoCfg.Password,
+		})
+	}
+
+	mdb, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		panic(err)
+	}
+
+	// check connect
+	err = mdb.Ping(ctx, nil)
+	if err != nil {
+		panic(err)
+	}
+	return mdb.Database(mongoCfg.Database)
+}
+
 func (w *WorkflowRecord) setErrorHandler(handler func(error)) {
 	w.errorHandler = handler
 	w.asyncPool.captureException = func(ctx context.Context, err any) {
@@ -757,6 +1413,7 @@ type TaskStatus struct {
 	err       error
 	statement []byte
 	option    string
+	attempt   int
 }
 
 func (t *TaskStatus) Error() string {
@@ -769,3 +1426,8 @@ func (t *TaskStatus) Error() string {
 func (t *TaskStatus) Statement() string {
 	return string(t.statement)
 }
+
+// Attempt starts from 1
+func (t *TaskStatus) Attempt() int {
+	return t.attempt
+}
@@ -0,0 +1,257 @@
+package beanq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/logger"
+)
+
+// WorkflowFilter the conditions of ListWorkflows, zero values match everything
+type WorkflowFilter struct {
+	Status        string
+	Type          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Position the cursor returned by the previous call, empty for the first page
+	Position string
+	// Limit default 20
+	Limit int64
+}
+
+// WorkflowProgress a workflow with its branches ordered by index,
+// each task owns a compensate branch followed by its action branch.
+type WorkflowProgress struct {
+	Global   TransGlobal   `json:"global"`
+	Branches []TransBranch `json:"branches"`
+}
+
+// Stuck the branches the workflow is waiting on in the current direction, the tasks run as a graph so there may be several:
+// the pending actions whose dependencies have succeeded while it's prepared, and the pending compensations
+// of the tasks whose dependents have been rolled back while it's aborting.
+func (p *WorkflowProgress) Stuck() []TransBranch {
+	w := &Workflow{progresses: append([]TransBranch{}, p.Branches...)}
+	actions, compensates := w.initSteps()
+
+	var pending []*TransBranch
+	switch p.Global.Status {
+	case StatusPrepared:
+		pending = actions()
+	case StatusAborting:
+		pending = compensates()
+	}
+
+	stuck := make([]TransBranch, 0, len(pending))
+	for _, branch := range pending {
+		stuck = append(stuck, *branch)
+	}
+	return stuck
+}
+
+func workflowStore() (TransStore, error) {
+	if workflowTransStore == nil {
+		return nil, errors.New("workflow client not initialized")
+	}
+	return workflowTransStore, nil
+}
+
+// lockWorkflow takes the lock Workflow.Run holds while it runs `gid` and fails at once if it's held,
+// without redis there is no lock.
+func lockWorkflow(ctx context.Context, gid string) (func(), error) {
+	if workflowMux == nil {
+		return func() {}, nil
+	}
+	mux := workflowMux.NewMutex(gid, WithTries(1), WithFailFast(true))
+	if err := mux.LockContext(ctx); err != nil {
+		if errors.Is(err, ErrTaken) || errors.Is(err, ErrFailed) {
+			return nil, fmt.Errorf("workflow %s is running: %w", gid, err)
+		}
+		return nil, err
+	}
+	return func() {
+		if _, err := mux.UnlockContext(context.WithoutCancel(ctx)); err != nil {
+			logger.New().Error(err)
+		}
+	}, nil
+}
+
+// GetWorkflow the global and the branches of the workflow `gid`. InitWorkflow must be called first.
+func (c *Client) GetWorkflow(ctx context.Context, gid string) (*WorkflowProgress, error) {
+	store, err := workflowStore()
+	if err != nil {
+		return nil, err
+	}
+
+	global, err := store.FindGlobal(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+	if global == nil {
+		return nil, fmt.Errorf("workflow %s: %w", gid, ErrNotFound)
+	}
+
+	branches, err := store.FindBranches(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		return branches[i].Index < branches[j].Index
+	})
+
+	return &WorkflowProgress{Global: *global, Branches: branches}, nil
+}
+
+// ListWorkflows one page of the workflows matching `filter`, the returned position is empty on the last page.
+// The order depends on the trans store, with redis a page may hold less than Limit workflows.
+func (c *Client) ListWorkflows(ctx context.Context, filter WorkflowFilter) ([]TransGlobal, string, error) {
+	store, err := workflowStore()
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	position := filter.Position
+	globals, err := store.ScanGlobals(ctx, &position, limit, TransGlobalScanCondition{
+		Status:          filter.Status,
+		TransType:       filter.Type,
+		CreateTimeStart: filter.CreatedAfter,
+		CreateTimeEnd:   filter.CreatedBefore,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return globals, position, nil
+}
+
+// ForceCompensateWorkflow move a prepared workflow to aborting and publish its message again,
+// the tasks which have run are rolled back as if the current one had failed. It fails while the workflow is running.
+func (c *Client) ForceCompensateWorkflow(ctx context.Context, gid, reason string) error {
+	store, err := workflowStore()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockWorkflow(ctx, gid)
+	if err != nil {
+		return err
+	}
+	err = forceCompensate(ctx, store, gid, reason)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	return resumeWorkflow(ctx, store, c.broker, gid)
+}
+
+func forceCompensate(ctx context.Context, store TransStore, gid, reason string) error {
+	global, err := store.FindGlobal(ctx, gid)
+	if err != nil {
+		return err
+	}
+	if global == nil {
+		return fmt.Errorf("workflow %s: %w", gid, ErrNotFound)
+	}
+	if global.Status != StatusPrepared {
+		return fmt.Errorf("workflow %s is %s, only prepared workflows can be compensated", gid, global.Status)
+	}
+
+	if reason == "" {
+		reason = "compensation forced"
+	}
+	now := time.Now()
+	global.Reason = reason
+	global.UpdateTime = &now
+	return store.ChangeGlobalStatus(ctx, global, StatusAborting, []string{"status", "update_time", "reason"}, false, -1)
+}
+
+// MarkBranchSucceeded mark the branch at `index` as succeeded and publish the workflow message again,
+// e.g. the action has been done by hand or a compensation keeps failing. It fails while the workflow is running.
+func (c *Client) MarkBranchSucceeded(ctx context.Context, gid string, index int) error {
+	store, err := workflowStore()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockWorkflow(ctx, gid)
+	if err != nil {
+		return err
+	}
+	changed, err := c.markBranchSucceeded(ctx, store, gid, index)
+	unlock()
+	if err != nil || !changed {
+		return err
+	}
+
+	return resumeWorkflow(ctx, store, c.broker, gid)
+}
+
+func (c *Client) markBranchSucceeded(ctx context.Context, store TransStore, gid string, index int) (bool, error) {
+	progress, err := c.GetWorkflow(ctx, gid)
+	if err != nil {
+		return false, err
+	}
+
+	status := progress.Global.Status
+	if status != StatusPrepared && status != StatusAborting {
+		return false, fmt.Errorf("workflow %s is %s, its branches can't be changed", gid, status)
+	}
+	if index < 0 || index >= len(progress.Branches) {
+		return false, fmt.Errorf("workflow %s has no branch %d", gid, index)
+	}
+
+	branch := progress.Branches[index]
+	if branch.Status == StatusSucceed {
+		return false, nil
+	}
+	now := time.Now()
+	branch.Status = StatusSucceed
+	branch.FinishTime = &now
+	branch.UpdateTime = &now
+
+	if err := store.LockGlobalSaveBranches(ctx, gid, status, []TransBranch{branch}, branch.Index); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// workflowInspector serves the workflow endpoints of the UI
+type workflowInspector struct {
+	client *Client
+}
+
+func (w *workflowInspector) ListWorkflows(ctx context.Context, status, workflowType, position string, limit int64) (any, string, error) {
+	return w.client.ListWorkflows(ctx, WorkflowFilter{
+		Status:   status,
+		Type:     workflowType,
+		Position: position,
+		Limit:    limit,
+	})
+}
+
+func (w *workflowInspector) GetWorkflow(ctx context.Context, gid string) (any, error) {
+	progress, err := w.client.GetWorkflow(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"global":   progress.Global,
+		"branches": progress.Branches,
+		"stuck":    progress.Stuck(),
+	}, nil
+}
+
+func (w *workflowInspector) ForceCompensate(ctx context.Context, gid, reason string) error {
+	return w.client.ForceCompensateWorkflow(ctx, gid, reason)
+}
+
+func (w *workflowInspector) MarkBranchSucceeded(ctx context.Context, gid string, index int) error {
+	return w.client.MarkBranchSucceeded(ctx, gid, index)
+}
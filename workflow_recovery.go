@@ -0,0 +1,217 @@
+package beanq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/helper/logger"
+)
+
+var workflowRegistry = struct {
+	handlers map[string]map[int]WorkflowHandler
+	sync.RWMutex
+}{handlers: make(map[string]map[int]WorkflowHandler)}
+
+// RegisterWorkflow register the handler which rebuilds the tasks of `workflowType`,
+// it's usually the same WorkflowHandler given to the consumer.
+// Workflows without WfOptionType have the type "workflow".
+func RegisterWorkflow(workflowType string, handler WorkflowHandler) {
+	RegisterWorkflowVersion(workflowType, 0, handler)
+}
+
+// RegisterWorkflowVersion register one version of the task definition of `workflowType`,
+// keep the old versions registered until the sagas started with them have finished.
+// Workflows without WfOptionVersion have the version 0.
+func RegisterWorkflowVersion(workflowType string, version int, handler WorkflowHandler) {
+	workflowRegistry.Lock()
+	defer workflowRegistry.Unlock()
+
+	if workflowRegistry.handlers[workflowType] == nil {
+		workflowRegistry.handlers[workflowType] = make(map[int]WorkflowHandler)
+	}
+	workflowRegistry.handlers[workflowType][version] = handler
+}
+
+func registeredWorkflow(workflowType string, version int) (WorkflowHandler, bool) {
+	workflowRegistry.RLock()
+	defer workflowRegistry.RUnlock()
+
+	handler, ok := workflowRegistry.handlers[workflowType][version]
+	return handler, ok
+}
+
+func latestWorkflowVersion(workflowType string) (int, bool) {
+	workflowRegistry.RLock()
+	defer workflowRegistry.RUnlock()
+
+	latest, found := 0, false
+	for version := range workflowRegistry.handlers[workflowType] {
+		if !found || version > latest {
+			latest, found = version, true
+		}
+	}
+	return latest, found
+}
+
+// VersionedWorkflow the consumer handler of `workflowType`, a new saga runs with the latest registered version
+// and a resumed one with the version it started with.
+func VersionedWorkflow(workflowType string) WorkflowHandler {
+	return func(ctx context.Context, workflow *Workflow) error {
+		version, ok := latestWorkflowVersion(workflowType)
+		if !ok {
+			return fmt.Errorf("no workflow registered for type %q", workflowType)
+		}
+
+		global, err := workflow.transStore.FindGlobal(ctx, workflow.gid)
+		if err != nil {
+			return err
+		}
+		if global != nil {
+			version = global.Version
+		}
+
+		handler, ok := registeredWorkflow(workflowType, version)
+		if !ok {
+			return fmt.Errorf("%w: %s version %d is not registered", ErrWorkflowVersion, workflowType, version)
+		}
+		workflow.Init(WfOptionType(workflowType), WfOptionVersion(version))
+		return handler(ctx, workflow)
+	}
+}
+
+// WorkflowRecovery re-drives the workflows left in prepared or aborting,
+// e.g. the consumer crashed between two tasks.
+type WorkflowRecovery struct {
+	transStore TransStore
+	broker     *Broker
+	mux        *MuxClient
+	interval   time.Duration
+	staleAfter time.Duration
+	batch      int64
+}
+
+// NewWorkflowRecovery scan every `interval` for the workflows which have not been updated for `staleAfter`.
+// InitWorkflow must be called first, the workflows are scanned in its trans store.
+func NewWorkflowRecovery(interval, staleAfter time.Duration) *WorkflowRecovery {
+	if workflowTransStore == nil {
+		panic("workflow client not initialized")
+	}
+
+	// without redis the instances are not locked against each other
+	return &WorkflowRecovery{
+		transStore: workflowTransStore,
+		mux:        workflowMux,
+		interval:   interval,
+		staleAfter: staleAfter,
+		batch:      100,
+	}
+}
+
+// SetBatch the number of globals read by one scan call
+func (r *WorkflowRecovery) SetBatch(batch int64) *WorkflowRecovery {
+	if batch > 0 {
+		r.batch = batch
+	}
+	return r
+}
+
+// SetClient lets the re-driven workflows publish child workflows and resume their parents
+func (r *WorkflowRecovery) SetClient(client *Client) *WorkflowRecovery {
+	r.broker = client.broker
+	return r
+}
+
+// Run blocks until ctx is done
+func (r *WorkflowRecovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Scan(ctx); err != nil {
+				logger.New().Error(err)
+			}
+		}
+	}
+}
+
+// Scan re-drive the stale workflows once, returns how many of them have been re-driven
+func (r *WorkflowRecovery) Scan(ctx context.Context) (int, error) {
+	var (
+		recovered int
+		errs      error
+	)
+	deadline := time.Now().Add(-r.staleAfter)
+
+	for _, status := range []string{StatusPrepared, StatusAborting} {
+		position := ""
+		for {
+			globals, err := r.transStore.ScanGlobals(ctx, &position, r.batch, TransGlobalScanCondition{Status: status})
+			if err != nil {
+				return recovered, errors.Join(errs, err)
+			}
+
+			for _, global := range globals {
+				if global.UpdateTime == nil || global.UpdateTime.After(deadline) {
+					continue
+				}
+				ok, err := r.recover(ctx, global)
+				if err != nil {
+					errs = errors.Join(errs, fmt.Errorf("[workflow recovery] %s: %w", global.Gid, err))
+					continue
+				}
+				if ok {
+					recovered++
+				}
+			}
+
+			if position == "" {
+				break
+			}
+		}
+	}
+
+	return recovered, errs
+}
+
+func (r *WorkflowRecovery) recover(ctx context.Context, global TransGlobal) (bool, error) {
+	handler, ok := registeredWorkflow(global.TransType, global.Version)
+	if !ok {
+		return false, fmt.Errorf("no workflow registered for type %q version %d", global.TransType, global.Version)
+	}
+	if global.MessageData == "" {
+		return false, errors.New("no message data to rebuild the workflow")
+	}
+
+	var message Message
+	if err := json.Unmarshal([]byte(global.MessageData), &message); err != nil {
+		return false, err
+	}
+
+	wf, err := NewWorkflow(ctx, &message)
+	if err != nil {
+		return false, err
+	}
+	wf.transaction.TransType = global.TransType
+	wf.transaction.Version = global.Version
+	wf.broker = r.broker
+	wf.transStore = r.transStore
+	// the same lock as the consumers take in Workflow.Run, the scanner skips the workflow while it's held
+	if r.mux != nil {
+		wf.Init(WfOptionMux(r.mux.NewMutex(global.Gid, WithTries(1))))
+	}
+
+	err = handler(ctx, wf)
+	if errors.Is(err, ErrFailed) || errors.Is(err, ErrTaken) || errors.Is(err, ErrWorkflowOngoing) {
+		// another instance is re-driving it, or it's still waiting for a signal
+		return false, nil
+	}
+	return err == nil, err
+}
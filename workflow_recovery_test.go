@@ -0,0 +1,104 @@
+package beanq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// withWorkflowGlobals stands in for InitWorkflow, with the trans store and the lock of the test
+func withWorkflowGlobals(t *testing.T, store TransStore, mux *MuxClient) {
+	transStore, lock, config := workflowTransStore, workflowMux, workflowConfig.WorkFlow
+	workflowTransStore, workflowMux = store, mux
+	if workflowConfig.WorkFlow == nil {
+		workflowConfig.WorkFlow = &WorkFlow{}
+	}
+	t.Cleanup(func() {
+		workflowTransStore, workflowMux, workflowConfig.WorkFlow = transStore, lock, config
+	})
+}
+
+func TestWorkflowRecovery_Scan(t *testing.T) {
+	store := NewMemoryTransStore()
+	mux := newTestMux(t, "beanq_workflow_test:recovery")
+	withWorkflowGlobals(t, store, mux)
+
+	var charged int
+	RegisterWorkflow("order-recovery", func(ctx context.Context, wf *Workflow) error {
+		wf.Init(WfOptionType("order-recovery"))
+		wf.NewTask("charge").OnExecute(func(task Task) error {
+			charged++
+			return nil
+		})
+		return wf.Run()
+	})
+	handler, _ := registeredWorkflow("order-recovery", 0)
+
+	// the consumer stops right after the saga is saved
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wf, err := NewWorkflow(ctx, &Message{Id: "order-8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := wf.wfMux.(*Mutex).Name(); name != "beanq_workflow_test:recovery:order-8" {
+		t.Fatalf("Expected the consumer to lock the workflow by its gid, got: %s", name)
+	}
+	// the cancelled context couldn't take the lock
+	wf.wfMux = nil
+	if err := handler(ctx, wf); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := store.FindGlobal(context.Background(), "order-8"); saved.Status != StatusPrepared || charged != 0 {
+		t.Fatalf("Expected the saga to be left prepared, got: %s %d", saved.Status, charged)
+	}
+
+	recovery := NewWorkflowRecovery(time.Minute, 0)
+
+	// a consumer is running it
+	running := mux.NewMutex("order-8", WithTries(1))
+	if err := running.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := recovery.Scan(context.Background())
+	if err != nil || recovered != 0 || charged != 0 {
+		t.Fatalf("Expected the scanner to skip the locked workflow, got: %d %d %v", recovered, charged, err)
+	}
+
+	if _, err := running.UnlockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err = recovery.Scan(context.Background())
+	if err != nil || recovered != 1 || charged != 1 {
+		t.Fatalf("Expected the workflow to be re-driven, got: %d %d %v", recovered, charged, err)
+	}
+	saved, err := store.FindGlobal(context.Background(), "order-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusSucceed {
+		t.Errorf("Expected the workflow to succeed, got: %s", saved.Status)
+	}
+
+	// nothing is left to re-drive
+	if recovered, err = recovery.Scan(context.Background()); err != nil || recovered != 0 {
+		t.Errorf("Expected nothing to re-drive, got: %d %v", recovered, err)
+	}
+}
+
+func TestWorkflowRecovery_recover(t *testing.T) {
+	store := NewMemoryTransStore()
+	withWorkflowGlobals(t, store, nil)
+	recovery := NewWorkflowRecovery(time.Minute, 0)
+
+	_, err := recovery.recover(context.Background(), TransGlobal{Gid: "order-9", TransType: "not-registered"})
+	if err == nil {
+		t.Error("Expected an unregistered type to fail")
+	}
+
+	RegisterWorkflow("order-no-message", func(ctx context.Context, wf *Workflow) error { return wf.Run() })
+	_, err = recovery.recover(context.Background(), TransGlobal{Gid: "order-9", TransType: "order-no-message"})
+	if err == nil {
+		t.Error("Expected a workflow without message data to fail")
+	}
+}
@@ -1,17 +1,41 @@
 package beanq
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/retail-ai-inc/beanq/v4/internal/btype"
 )
 
+// newTestWorkflow the workflow NewWorkflow builds for message, on store instead of the package globals
+func newTestWorkflow(t *testing.T, store TransStore, message *Message) *Workflow {
+	t.Helper()
+	global, err := NewTransGlobal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Workflow{
+		ctx:         context.Background(),
+		gid:         message.workflowGid(),
+		message:     message,
+		record:      &WorkflowRecord{errorHandler: func(error) {}},
+		transStore:  store,
+		transaction: global,
+	}
+}
+
 func TestWorkflow_initSteps(t *testing.T) {
-	w := &Workflow{
-		progresses: []TransBranch{
-			{TaskID: "c1", Status: StatusPrepared}, // Step0
-			{TaskID: "a1", Status: StatusPrepared}, // Step1
-			{TaskID: "c2", Status: StatusPrepared}, // Step2
-			{TaskID: "a2", Status: StatusPrepared}, // Step3
-		},
+	w := newTestWorkflow(t, nil, &Message{})
+	w.progresses = []TransBranch{
+		{TaskID: "c1", Status: StatusPrepared}, // Step0
+		{TaskID: "a1", Status: StatusPrepared}, // Step1
+		{TaskID: "c2", Status: StatusPrepared}, // Step2
+		{TaskID: "a2", Status: StatusPrepared}, // Step3
 	}
 
 	actions, compensates := w.initSteps()
@@ -40,3 +64,609 @@ func TestWorkflow_initSteps(t *testing.T) {
 		t.Errorf("Expected c2 to be rollback target, got: %+v", compensateList[0].TaskID)
 	}
 }
+
+func TestWorkflow_initStepsDependsOn(t *testing.T) {
+	w := newTestWorkflow(t, nil, &Message{})
+	w.progresses = []TransBranch{
+		{TaskID: "reserve", Status: StatusPrepared, DependsOn: []string{}},
+		{TaskID: "reserve", Status: StatusPrepared, DependsOn: []string{}},
+		{TaskID: "validate", Status: StatusPrepared, DependsOn: []string{}},
+		{TaskID: "validate", Status: StatusPrepared, DependsOn: []string{}},
+		{TaskID: "charge", Status: StatusPrepared, DependsOn: []string{"reserve", "validate"}},
+		{TaskID: "charge", Status: StatusPrepared, DependsOn: []string{"reserve", "validate"}},
+	}
+
+	actions, compensates := w.initSteps()
+
+	actionsList := actions()
+	if len(actionsList) != 2 || actionsList[0].TaskID != "reserve" || actionsList[1].TaskID != "validate" {
+		t.Fatalf("Expected reserve and validate to be executable, got: %+v", actionsList)
+	}
+
+	actionsList[0].Status = StatusSucceed
+	if actionsList = actions(); len(actionsList) != 1 || actionsList[0].TaskID != "validate" {
+		t.Fatalf("Expected charge to wait for validate, got: %+v", actionsList)
+	}
+
+	actionsList[0].Status = StatusSucceed
+	if actionsList = actions(); len(actionsList) != 1 || actionsList[0].TaskID != "charge" {
+		t.Fatalf("Expected only charge to be executable, got: %+v", actionsList)
+	}
+
+	actionsList[0].Status = StatusFailed
+	compensateList := compensates()
+	if len(compensateList) != 1 || compensateList[0].TaskID != "charge" {
+		t.Fatalf("Expected charge to be rolled back first, got: %+v", compensateList)
+	}
+
+	compensateList[0].Status = StatusSucceed
+	if compensateList = compensates(); len(compensateList) != 2 {
+		t.Fatalf("Expected reserve and validate to be rolled back together, got: %+v", compensateList)
+	}
+}
+
+func TestTasks_dependencies(t *testing.T) {
+	w := newTestWorkflow(t, nil, &Message{})
+	w.NewTask("a")
+	w.NewTask("b").DependsOn()
+	w.NewTask("c").DependsOn("a", "b")
+
+	deps, err := w.tasks.dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps[0]) != 0 || len(deps[1]) != 0 || len(deps[2]) != 2 {
+		t.Errorf("Unexpected dependencies: %+v", deps)
+	}
+
+	w.NewTask("d").DependsOn("e")
+	w.NewTask("e").DependsOn("d")
+	if _, err := w.tasks.dependencies(); err == nil {
+		t.Error("Expected a cycle error")
+	}
+}
+
+func TestTask_RetryAndTimeout(t *testing.T) {
+	w := newTestWorkflow(t, nil, &Message{})
+
+	calls := 0
+	err := w.NewTask("flaky").Retry(RetryPolicy{Retries: 2, MinBackoff: time.Millisecond}).OnExecute(func(task Task) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	}).Execute()
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success on the third attempt, got: %v after %d calls", err, calls)
+	}
+
+	err = w.NewTask("slow").Timeout(10 * time.Millisecond).OnExecute(func(task Task) error {
+		<-task.(TaskContext).Context().Done()
+		return nil
+	}).Execute()
+	if !errors.Is(err, ErrTaskTimeout) {
+		t.Errorf("Expected ErrTaskTimeout, got: %v", err)
+	}
+
+	// a timed out attempt returns before the next one starts
+	var running, overlapped atomic.Bool
+	err = w.NewTask("overlap").Timeout(10 * time.Millisecond).Retry(RetryPolicy{Retries: 1, MinBackoff: time.Millisecond}).
+		OnExecute(func(task Task) error {
+			if running.Swap(true) {
+				overlapped.Store(true)
+			}
+			defer running.Store(false)
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		}).Execute()
+	if !errors.Is(err, ErrTaskTimeout) || overlapped.Load() {
+		t.Errorf("Expected the attempts to time out one after the other, got: %v %v", err, overlapped.Load())
+	}
+}
+
+func TestWorkflow_RunWithMemoryTransStore(t *testing.T) {
+	store := NewMemoryTransStore()
+	w := newTestWorkflow(t, store, &Message{Id: "order-1"})
+
+	var (
+		mu         sync.Mutex
+		rolledBack []string
+	)
+	rollback := func(task Task) error {
+		mu.Lock()
+		defer mu.Unlock()
+		rolledBack = append(rolledBack, task.ID())
+		return nil
+	}
+	succeed := func(task Task) error { return nil }
+
+	w.NewTask("reserve").DependsOn().OnExecute(succeed).OnRollback(rollback)
+	w.NewTask("validate").DependsOn().OnExecute(succeed).OnRollback(rollback)
+	w.NewTask("charge").DependsOn("reserve", "validate").OnExecute(func(task Task) error {
+		return errors.New("card declined")
+	}).OnRollback(rollback)
+
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.FindGlobal(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusFailed {
+		t.Errorf("Expected the workflow to be failed, got: %s", saved.Status)
+	}
+	if len(rolledBack) != 3 || rolledBack[0] != "charge" {
+		t.Errorf("Expected charge to be rolled back before reserve and validate, got: %v", rolledBack)
+	}
+}
+
+func TestWorkflow_WaitForSignal(t *testing.T) {
+	store := NewMemoryTransStore()
+
+	var approved []byte
+	define := func(w *Workflow, timeout time.Duration) {
+		w.NewTask("approve").WaitForSignal("approval", timeout).OnExecute(func(task Task) error {
+			approved = task.(TaskSignal).SignalPayload()
+			return nil
+		})
+	}
+
+	w := newTestWorkflow(t, store, &Message{Id: "order-2"})
+	define(w, time.Hour)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	if err := store.SaveSignal(context.Background(), "order-2", "approval", []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	w = newTestWorkflow(t, store, &Message{Id: "resumed", WorkflowGid: "order-2"})
+	define(w, time.Hour)
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if string(approved) != "ok" || w.transaction.Status != StatusSucceed {
+		t.Errorf("Expected the workflow to succeed with the signal, got: %q %s", approved, w.transaction.Status)
+	}
+
+	w = newTestWorkflow(t, store, &Message{Id: "order-3"})
+	define(w, time.Millisecond)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	w = newTestWorkflow(t, store, &Message{Id: "order-3"})
+	define(w, time.Millisecond)
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.transaction.Status != StatusFailed {
+		t.Errorf("Expected the timed out workflow to be compensated, got: %s", w.transaction.Status)
+	}
+}
+
+func TestClient_SignalWorkflowIn(t *testing.T) {
+	client := New(newTestConfig(t, "beanq_signal_test"))
+	defer client.Close()
+	withWorkflowGlobals(t, NewMemoryTransStore(), nil)
+
+	// the workflow keeps its progress in its own store
+	store := NewMemoryTransStore()
+	w := newTestWorkflow(t, store, &Message{Id: "order-13", Channel: "signal-channel", Topic: "signal-topic", MoodType: btype.NORMAL})
+	w.NewTask("approve").WaitForSignal("approval", time.Hour)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	if err := client.SignalWorkflow(context.Background(), "order-13", "approval", []byte("ok")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the workflow not to be in the store of InitWorkflow, got: %v", err)
+	}
+	if err := client.SignalWorkflowIn(context.Background(), store, "order-13", "approval", []byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	if payload, ok, err := store.FindSignal(context.Background(), "order-13", "approval"); err != nil || !ok || string(payload) != "ok" {
+		t.Errorf("Expected the signal in the store of the workflow, got: %q %v %v", payload, ok, err)
+	}
+}
+
+func TestWorkflow_ChildWorkflow(t *testing.T) {
+	store := NewMemoryTransStore()
+	newWorkflow := func(id string) *Workflow {
+		return newTestWorkflow(t, store, &Message{Id: id})
+	}
+	finishChild := func(gid, status string) {
+		child := newWorkflow(gid)
+		if err := store.MaySaveNew(context.Background(), child.transaction, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := child.ChangeStatus(context.Background(), status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finishChild("merchant-1-account", StatusSucceed)
+	w := newWorkflow("merchant-1")
+	w.NewTask("account").ChildWorkflow("saga", "create-account", nil)
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.transaction.Status != StatusSucceed {
+		t.Errorf("Expected the parent to succeed with its child, got: %s", w.transaction.Status)
+	}
+
+	finishChild("merchant-2-account", StatusFailed)
+	w = newWorkflow("merchant-2")
+	w.NewTask("account").ChildWorkflow("saga", "create-account", nil)
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if w.transaction.Status != StatusFailed {
+		t.Errorf("Expected the parent to fail with its child, got: %s", w.transaction.Status)
+	}
+}
+
+func TestClient_GetWorkflow(t *testing.T) {
+	store := NewMemoryTransStore()
+	old := workflowTransStore
+	workflowTransStore = store
+	defer func() { workflowTransStore = old }()
+
+	w := newTestWorkflow(t, store, &Message{Id: "order-4"})
+	w.NewTask("reserve").OnExecute(func(task Task) error { return nil })
+	w.NewTask("approve").WaitForSignal("approval", time.Hour)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	client := &Client{}
+	progress, err := client.GetWorkflow(context.Background(), "order-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress.Branches) != 4 {
+		t.Fatalf("Expected 4 branches, got: %d", len(progress.Branches))
+	}
+	stuck := progress.Stuck()
+	if len(stuck) != 1 || stuck[0].TaskID != "approve" || stuck[0].Op != OpAction || stuck[0].WaitUntil == nil {
+		t.Errorf("Expected the workflow to be stuck at the approve action, got: %+v", stuck)
+	}
+
+	globals, position, err := client.ListWorkflows(context.Background(), WorkflowFilter{Status: StatusPrepared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(globals) != 1 || globals[0].Gid != "order-4" || position != "" {
+		t.Errorf("Expected order-4 on a single page, got: %v %q", globals, position)
+	}
+
+	if _, err := client.GetWorkflow(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+}
+
+func TestWorkflowProgress_Stuck(t *testing.T) {
+	// ship and invoice both depend on reserve
+	branch := func(index int, taskID, op, status string, dependsOn ...string) TransBranch {
+		return TransBranch{Index: index, TaskID: taskID, Op: op, Status: status, DependsOn: append([]string{}, dependsOn...)}
+	}
+	progress := &WorkflowProgress{
+		Global: TransGlobal{Status: StatusPrepared},
+		Branches: []TransBranch{
+			branch(0, "reserve", OpCompensate, StatusPrepared), branch(1, "reserve", OpAction, StatusSucceed),
+			branch(2, "ship", OpCompensate, StatusPrepared), branch(3, "ship", OpAction, StatusPrepared, "reserve"),
+			branch(4, "invoice", OpCompensate, StatusPrepared), branch(5, "invoice", OpAction, StatusPrepared, "reserve"),
+		},
+	}
+	indexes := func(branches []TransBranch) []int {
+		var indexes []int
+		for _, b := range branches {
+			indexes = append(indexes, b.Index)
+		}
+		return indexes
+	}
+	if got := indexes(progress.Stuck()); !reflect.DeepEqual(got, []int{3, 5}) {
+		t.Errorf("Expected both parallel actions, got: %v", got)
+	}
+
+	// reserve is rolled back once both have been
+	progress.Global.Status = StatusAborting
+	progress.Branches[3].Status = StatusSucceed
+	progress.Branches[5].Status = StatusFailed
+	if got := indexes(progress.Stuck()); !reflect.DeepEqual(got, []int{4, 2}) {
+		t.Errorf("Expected both compensations in reverse order, got: %v", got)
+	}
+	progress.Branches[2].Status, progress.Branches[4].Status = StatusSucceed, StatusSucceed
+	if got := indexes(progress.Stuck()); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("Expected the reserve compensation, got: %v", got)
+	}
+
+	progress.Global.Status = StatusFailed
+	if stuck := progress.Stuck(); len(stuck) != 0 {
+		t.Errorf("Expected a finished workflow not to be stuck, got: %v", stuck)
+	}
+}
+
+func TestVersionedWorkflow(t *testing.T) {
+	store := NewMemoryTransStore()
+
+	var ran []string
+	succeed := func(task Task) error {
+		ran = append(ran, task.ID())
+		return nil
+	}
+	RegisterWorkflowVersion("order-versions", 1, func(ctx context.Context, wf *Workflow) error {
+		wf.NewTask("charge").WaitForSignal("paid", time.Hour).OnExecute(succeed)
+		return wf.Run()
+	})
+	handler := VersionedWorkflow("order-versions")
+
+	if err := handler(context.Background(), newTestWorkflow(t, store, &Message{Id: "order-5"})); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	// deploy a definition which adds a task before the old one
+	v2 := func(ctx context.Context, wf *Workflow) error {
+		wf.NewTask("reserve").OnExecute(succeed)
+		wf.NewTask("charge").WaitForSignal("paid", time.Hour).OnExecute(succeed)
+		return wf.Run()
+	}
+	RegisterWorkflowVersion("order-versions", 2, v2)
+
+	if err := store.SaveSignal(context.Background(), "order-5", "paid", nil); err != nil {
+		t.Fatal(err)
+	}
+	wf := newTestWorkflow(t, store, &Message{Id: "order-5"})
+	wf.Init(WfOptionVersion(2))
+	if err := v2(context.Background(), wf); !errors.Is(err, ErrWorkflowVersion) {
+		t.Fatalf("Expected the version 2 to refuse the saga, got: %v", err)
+	}
+
+	if err := handler(context.Background(), newTestWorkflow(t, store, &Message{Id: "order-5"})); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.FindGlobal(context.Background(), "order-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusSucceed || saved.Version != 1 || len(ran) != 1 || ran[0] != "charge" {
+		t.Errorf("Expected the saga to finish with version 1, got: %s %d %v", saved.Status, saved.Version, ran)
+	}
+
+	if err := handler(context.Background(), newTestWorkflow(t, store, &Message{Id: "order-6"})); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+	if saved, _ := store.FindGlobal(context.Background(), "order-6"); saved.Version != 2 {
+		t.Errorf("Expected a new saga to start with version 2, got: %d", saved.Version)
+	}
+}
+
+func TestTask_State(t *testing.T) {
+	store := NewMemoryTransStore()
+
+	type charge struct {
+		ID string `json:"id"`
+	}
+	var refunded string
+	define := func(w *Workflow) {
+		w.NewTask("charge").OnExecute(func(task Task) error {
+			return task.(TaskState).SetState(charge{ID: "ch_1"})
+		}).OnRollback(func(task Task) error {
+			var c charge
+			if err := task.(TaskState).State(&c); err != nil {
+				return err
+			}
+			refunded = c.ID
+			return nil
+		})
+		w.NewTask("ship").WaitForSignal("shipped", time.Hour)
+	}
+
+	w := newTestWorkflow(t, store, &Message{Id: "order-7"})
+	define(w)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	// the rollback runs in another process, with the state read back from the store
+	global, err := store.FindGlobal(context.Background(), "order-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ChangeGlobalStatus(context.Background(), global, StatusAborting, nil, false, -1); err != nil {
+		t.Fatal(err)
+	}
+	w = newTestWorkflow(t, store, &Message{Id: "order-7"})
+	define(w)
+	if err := w.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if refunded != "ch_1" || w.transaction.Status != StatusFailed {
+		t.Errorf("Expected the charge to be refunded, got: %q %s", refunded, w.transaction.Status)
+	}
+}
+
+func TestClient_inspectLocked(t *testing.T) {
+	store := NewMemoryTransStore()
+	mux := newTestMux(t, "beanq_workflow_test:inspect")
+	withWorkflowGlobals(t, store, mux)
+
+	w := newTestWorkflow(t, store, &Message{Id: "order-10"})
+	w.NewTask("reserve").OnExecute(func(task Task) error { return nil })
+	w.NewTask("approve").WaitForSignal("approval", time.Hour)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	// a consumer is running it
+	running := mux.NewMutex("order-10")
+	if err := running.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{}
+	if err := client.ForceCompensateWorkflow(context.Background(), "order-10", ""); !errors.Is(err, ErrTaken) {
+		t.Errorf("Expected the compensation to fail while the workflow runs, got: %v", err)
+	}
+	if err := client.MarkBranchSucceeded(context.Background(), "order-10", 3); !errors.Is(err, ErrTaken) {
+		t.Errorf("Expected the branch change to fail while the workflow runs, got: %v", err)
+	}
+	progress, err := client.GetWorkflow(context.Background(), "order-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Global.Status != StatusPrepared || progress.Branches[3].Status != StatusPrepared {
+		t.Errorf("Expected the workflow to be left untouched, got: %s %s", progress.Global.Status, progress.Branches[3].Status)
+	}
+
+	if _, err := running.UnlockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the reserve action has succeeded already, nothing is changed
+	if err := client.MarkBranchSucceeded(context.Background(), "order-10", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := running.LockContext(context.Background()); err != nil {
+		t.Errorf("Expected the lock to be released, got: %v", err)
+	}
+}
+
+func TestClient_repairWhileRunWaits(t *testing.T) {
+	store := NewMemoryTransStore()
+	mux := newTestMux(t, "beanq_workflow_test:repair")
+	withWorkflowGlobals(t, store, mux)
+
+	var reserved, released int32
+	define := func(w *Workflow) {
+		w.NewTask("reserve").OnExecute(func(task Task) error {
+			atomic.AddInt32(&reserved, 1)
+			return nil
+		}).OnRollback(func(task Task) error {
+			atomic.AddInt32(&released, 1)
+			return nil
+		})
+		w.NewTask("approve").WaitForSignal("approval", time.Hour)
+	}
+	w := newTestWorkflow(t, store, &Message{Id: "order-12"})
+	define(w)
+	if err := w.Run(); !errors.Is(err, ErrWorkflowOngoing) {
+		t.Fatalf("Expected the workflow to wait for the signal, got: %v", err)
+	}
+
+	// the repair holds the lock while the message is redelivered
+	repair := mux.NewMutex("order-12")
+	if err := repair.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	redelivered := newTestWorkflow(t, store, &Message{Id: "order-12"})
+	redelivered.wfMux = mux.NewMutex("order-12")
+	define(redelivered)
+	done := make(chan error, 1)
+	go func() {
+		done <- redelivered.Run()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := forceCompensate(context.Background(), store, "order-12", "cancelled by support"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repair.UnlockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.FindGlobal(context.Background(), "order-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusFailed || reserved != 1 || released != 1 {
+		t.Errorf("Expected the waiting run to roll back the repaired workflow, got: %s %d %d", saved.Status, reserved, released)
+	}
+}
+
+func TestTask_childMessage(t *testing.T) {
+	for _, mood := range []btype.MoodType{btype.NORMAL, btype.DELAY, btype.SEQUENCE, btype.SEQUENCE_BY_LOCK} {
+		w := newTestWorkflow(t, nil, &Message{Id: "merchant-3", MoodType: mood})
+		message := w.NewTask("account").ChildWorkflow("saga", "create-account", nil).childMessage("merchant-3-account", time.Now())
+
+		if message.Id != "merchant-3-account" || message.ParentGid != "merchant-3" {
+			t.Errorf("%s: Expected the child gid as id, got: %+v", mood, message)
+		}
+		sequence := mood == btype.SEQUENCE || mood == btype.SEQUENCE_BY_LOCK
+		if sequence && message.DedupKey != "" {
+			t.Errorf("%s: Expected the id to deduplicate the child, got the dedup key: %s", mood, message.DedupKey)
+		}
+		if !sequence && (message.DedupKey != "merchant-3-account" || message.DedupWindow != childDedupWindow) {
+			t.Errorf("%s: Expected the child to be deduplicated by its gid, got: %s %s", mood, message.DedupKey, message.DedupWindow)
+		}
+	}
+}
+
+// gidMux the lock the runs of one gid share in the process
+type gidMux struct {
+	held chan struct{}
+}
+
+func (m *gidMux) Name() string     { return "gid" }
+func (m *gidMux) Value() string    { return "" }
+func (m *gidMux) Until() time.Time { return time.Time{} }
+func (m *gidMux) LockContext(ctx context.Context) error {
+	select {
+	case m.held <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+func (m *gidMux) UnlockContext(ctx context.Context) (bool, error) {
+	<-m.held
+	return true, nil
+}
+func (m *gidMux) ExtendContext(ctx context.Context) (bool, error) { return true, nil }
+
+func TestWorkflow_RunOverlapped(t *testing.T) {
+	store := NewMemoryTransStore()
+	mux := &gidMux{held: make(chan struct{}, 1)}
+
+	var reserved, charged atomic.Int32
+	entered, release := make(chan struct{}), make(chan struct{})
+	run := func() error {
+		w := newTestWorkflow(t, store, &Message{Id: "order-11"})
+		w.Init(WfOptionMux(mux))
+		w.NewTask("reserve").OnExecute(func(task Task) error {
+			if reserved.Add(1) == 1 {
+				close(entered)
+				<-release
+			}
+			return nil
+		})
+		w.NewTask("charge").OnExecute(func(task Task) error {
+			charged.Add(1)
+			return nil
+		})
+		return w.Run()
+	}
+
+	first := make(chan error)
+	go func() { first <- run() }()
+	<-entered
+
+	// a redelivery of the same message waits for the first run
+	second := make(chan error)
+	go func() { second <- run() }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	if reserved.Load() != 1 || charged.Load() != 1 {
+		t.Errorf("Expected every action to run once, got reserve %d charge %d", reserved.Load(), charged.Load())
+	}
+}